@@ -0,0 +1,262 @@
+package log4g
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * 运行时查看和修改日志配置的 http.Handler ，可以挂载到已有的调试路由上
+ * eg. mux.Handle("/debug/log4g/", http.StripPrefix("/debug/log4g", log4g.NewAdminHandler()))
+ *
+ * GET  /                                              所有分类、过滤器、布局和输出，以及输出队列状态
+ * PUT  /level?category=db&level=DEBUG[&filter=main][&revert=5m]
+ *                                                     修改分类或单个过滤器的等级，revert 后自动恢复
+ *                                                     只能修改配置中的分类自己的过滤器，其他分类返回 404
+ * POST /reload                                        重新加载最近一次加载的配置文件
+ */
+func NewAdminHandler() http.Handler {
+	return &adminHandler{
+		reverts: map[*categoryFilter]*levelRevert{},
+	}
+}
+
+type adminHandler struct {
+	mu      sync.Mutex
+	reverts map[*categoryFilter]*levelRevert // 等待自动恢复等级的过滤器
+}
+
+// 自动恢复等级修改，记录的是第一次修改前的等级
+type levelRevert struct {
+	timer *time.Timer
+	level Level
+}
+
+type adminFilter struct {
+	Name    string   `json:"name,omitempty"`
+	Level   string   `json:"level"`
+	Layout  string   `json:"layout"`
+	Outputs []string `json:"outputs"`
+}
+
+type adminCategory struct {
+	Name    string        `json:"name"`
+	Filters []adminFilter `json:"filters"`
+}
+
+type adminQueue struct {
+	QueueDepth int    `json:"queue_depth"`
+	QueueSize  int    `json:"queue_size"`
+	Dropped    uint64 `json:"dropped"`
+	Errors     uint64 `json:"errors"`
+}
+
+// 控制台输出使用的流的写入队列，stdout 或 stderr
+type adminStream struct {
+	Name string `json:"name"`
+	adminQueue
+}
+
+// 控制台输出的队列状态为所有流的合计，各个流的状态在 streams 中
+type adminWriter struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	adminQueue
+	Streams []adminStream `json:"streams,omitempty"`
+}
+
+type adminStatus struct {
+	Categories []adminCategory `json:"categories"`
+	Writers    []adminWriter   `json:"writers"`
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch strings.Trim(r.URL.Path, "/") {
+	case "":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeAdminJson(w, http.StatusOK, getAdminStatus())
+	case "level":
+		if r.Method != http.MethodPut {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.putLevel(w, r)
+	case "reload":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := Reload(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeAdminJson(w, http.StatusOK, getAdminStatus())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *adminHandler) putLevel(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	name := query.Get("category")
+	if name == "" {
+		http.Error(w, "category is required", http.StatusBadRequest)
+		return
+	}
+
+	level, ok := parseLevel(query.Get("level"))
+	if !ok {
+		http.Error(w, "invalid level "+query.Get("level"), http.StatusBadRequest)
+		return
+	}
+
+	var revert time.Duration
+	if s := query.Get("revert"); s != "" {
+		if revert = strToDuration(s); revert <= 0 {
+			http.Error(w, "invalid revert "+s, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// 只修改分类在配置中自己的过滤器，没有时不修改父分类或根分类
+	filters, err := configuredFilters(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if filter := query.Get("filter"); filter != "" {
+		f, err := lookupFilter(name, filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		filters = []*categoryFilter{f}
+	}
+
+	h.setLevel(filters, level, revert)
+	writeAdminJson(w, http.StatusOK, getAdminCategory(name))
+}
+
+// 修改过滤器的等级，revert 大于 0 时到期后恢复为修改前的等级
+// 过滤器还有没到期的恢复时，取消它并沿用它记录的原始等级
+func (h *adminHandler) setLevel(filters []*categoryFilter, level Level, revert time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, f := range filters {
+		rv, ok := h.reverts[f]
+		if ok {
+			rv.timer.Stop()
+			delete(h.reverts, f)
+		} else {
+			rv = &levelRevert{level: f.getLevel()}
+		}
+
+		f.setLevel(level)
+		if revert <= 0 {
+			continue
+		}
+
+		f, rv := f, rv
+		h.reverts[f] = rv
+		rv.timer = time.AfterFunc(revert, func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+
+			if h.reverts[f] != rv {
+				return
+			}
+			delete(h.reverts, f)
+			f.setLevel(rv.level)
+			updateMinLevels()
+		})
+	}
+	updateMinLevels()
+}
+
+func getAdminCategory(name string) adminCategory {
+	c := adminCategory{Name: name}
+	for _, f := range resolvedFilters(name) {
+		layout := ""
+		if f.layout != nil {
+			layout = f.layout.Name
+		}
+		c.Filters = append(c.Filters, adminFilter{
+			Name:    f.name,
+			Level:   f.getLevel().String(),
+			Layout:  layout,
+			Outputs: f.outputs,
+		})
+	}
+	return c
+}
+
+func getAdminStatus() adminStatus {
+	gLoggerMu.Lock()
+	names := make([]string, 0, len(gLoggerMgr))
+	for name := range gLoggerMgr {
+		names = append(names, name)
+	}
+	writers := make([]adminWriter, 0, len(gOutputs)+2)
+	for _, name := range []string{kConsoleOutput, kStderrOutput} {
+		if _, ok := gOutputs[name]; !ok {
+			writers = append(writers, adminWriterOf(name, name, builtinOutput(name)))
+		}
+	}
+	for name, info := range gOutputs {
+		writers = append(writers, adminWriterOf(name, info.cfg.Type(), info.writer))
+	}
+	gLoggerMu.Unlock()
+
+	sort.Strings(names)
+	sort.Slice(writers, func(i, j int) bool {
+		return writers[i].Name < writers[j].Name
+	})
+
+	status := adminStatus{Writers: writers}
+	for _, name := range names {
+		status.Categories = append(status.Categories, getAdminCategory(name))
+	}
+	return status
+}
+
+func adminWriterOf(name, typ string, w Writer) adminWriter {
+	aw := adminWriter{Name: name, Type: typ}
+	if c, ok := w.(*consoleOutput); ok {
+		streams := c.streams()
+		for i, idx := range c.streamIndexes() {
+			q := adminQueueOf(streams[i])
+			aw.Streams = append(aw.Streams, adminStream{Name: kStreamNames[idx], adminQueue: q})
+			aw.QueueDepth += q.QueueDepth
+			aw.QueueSize += q.QueueSize
+			aw.Dropped += q.Dropped
+			aw.Errors += q.Errors
+		}
+	} else if q, ok := w.(*asyncWriter); ok {
+		aw.adminQueue = adminQueueOf(q)
+	}
+	return aw
+}
+
+func adminQueueOf(w *asyncWriter) adminQueue {
+	var q adminQueue
+	q.QueueDepth, q.QueueSize = w.QueueDepth()
+	q.Dropped = w.Dropped()
+	q.Errors = w.Errors()
+	return q
+}
+
+func writeAdminJson(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
@@ -0,0 +1,212 @@
+package log4g
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const kAdminTestConfig = `{
+	"categories": {
+		"admin_test": {"enable": true, "filters": [
+			{"name": "main", "level": "INFO", "output": ["console"]},
+			{"name": "audit", "level": "ERROR", "output": ["console"]}
+		]}
+	}
+}`
+
+func serveAdmin(h http.Handler, method, target string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(method, target, nil))
+	return rr
+}
+
+func loadAdminTestConfig(t *testing.T) {
+	if err := LoadJsonString(kAdminTestConfig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdminStatus(t *testing.T) {
+	loadAdminTestConfig(t)
+	defer Close()
+
+	rr := serveAdmin(NewAdminHandler(), http.MethodGet, "/")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET / returned %d: %s", rr.Code, rr.Body)
+	}
+
+	var status adminStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+		t.Fatalf("GET / returned invalid json: %v", err)
+	}
+
+	var found *adminCategory
+	for i := range status.Categories {
+		if status.Categories[i].Name == "admin_test" {
+			found = &status.Categories[i]
+		}
+	}
+	if found == nil {
+		t.Fatalf("category admin_test not listed: %s", rr.Body)
+	}
+	if len(found.Filters) != 2 || found.Filters[0].Name != "main" || found.Filters[0].Level != "INFO" {
+		t.Fatalf("unexpected filters %+v", found.Filters)
+	}
+
+	hasConsole := false
+	for _, w := range status.Writers {
+		if w.Name == kConsoleOutput {
+			hasConsole = w.QueueSize > 0
+		}
+	}
+	if !hasConsole {
+		t.Fatalf("console writer not listed with its queue: %+v", status.Writers)
+	}
+}
+
+func TestAdminPutLevelRevert(t *testing.T) {
+	loadAdminTestConfig(t)
+	defer Close()
+
+	h := NewAdminHandler()
+	rr := serveAdmin(h, http.MethodPut, "/level?category=admin_test&filter=main&level=DEBUG&revert=50ms")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("PUT /level returned %d: %s", rr.Code, rr.Body)
+	}
+
+	if level, _ := GetFilterLevel("admin_test", "main"); level != DEBUG {
+		t.Fatalf("main level is %v after PUT, want DEBUG", level)
+	}
+	if level, _ := GetFilterLevel("admin_test", "audit"); level != ERROR {
+		t.Fatalf("audit level changed to %v, only main should change", level)
+	}
+	if !GetLogger("admin_test").IsEnabled(DEBUG) {
+		t.Fatal("DEBUG not enabled after PUT")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if level, _ := GetFilterLevel("admin_test", "main"); level == INFO {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("main level was not reverted to INFO")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if GetLogger("admin_test").IsEnabled(DEBUG) {
+		t.Fatal("DEBUG still enabled after revert")
+	}
+}
+
+func TestAdminPutLevelErrors(t *testing.T) {
+	loadAdminTestConfig(t)
+	defer Close()
+
+	h := NewAdminHandler()
+	tests := []struct {
+		target string
+		code   int
+	}{
+		{"/level?level=DEBUG", http.StatusBadRequest},
+		{"/level?category=admin_test&level=LOUD", http.StatusBadRequest},
+		{"/level?category=admin_test&level=DEBUG&revert=soon", http.StatusBadRequest},
+		{"/level?category=admin_test&level=DEBUG&filter=missing", http.StatusNotFound},
+		{"/level?category=admin_test_missing&level=DEBUG", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if rr := serveAdmin(h, http.MethodPut, test.target); rr.Code != test.code {
+			t.Errorf("PUT %s returned %d, want %d", test.target, rr.Code, test.code)
+		}
+	}
+
+	if _, ok := findCategory("admin_test_missing"); ok {
+		t.Fatal("PUT registered an unknown category")
+	}
+}
+
+func TestAdminConsoleStreams(t *testing.T) {
+	err := LoadJsonString(`{
+		"files": {"con": {"type": "console", "stderr_level": "ERROR", "queue_size": 8}},
+		"categories": {"admin_test": {"enable": true, "filters": [{"output": ["con"]}]}}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	var status adminStatus
+	rr := serveAdmin(NewAdminHandler(), http.MethodGet, "/")
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+		t.Fatalf("GET / returned invalid json: %v", err)
+	}
+
+	for _, w := range status.Writers {
+		if w.Name != "con" {
+			continue
+		}
+		if len(w.Streams) != 2 || w.Streams[0].Name != "stdout" || w.Streams[1].Name != "stderr" {
+			t.Fatalf("unexpected streams %+v", w.Streams)
+		}
+		if w.Streams[1].QueueSize != 8 || w.QueueSize != 16 {
+			t.Fatalf("unexpected queue sizes %+v", w)
+		}
+		return
+	}
+	t.Fatalf("writer con not listed: %+v", status.Writers)
+}
+
+func TestAdminReloadWithoutConfig(t *testing.T) {
+	file, _ := gConfigFile.Load().(configFile)
+	setConfigFile("", "")
+	defer setConfigFile(file.path, file.format)
+
+	rr := serveAdmin(NewAdminHandler(), http.MethodPost, "/reload")
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("POST /reload returned %d, want %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+// 重新加载时使用加载时的格式，不按扩展名选择
+func TestAdminReloadKeepsFormat(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log4g.json")
+	content := "categories:\n  admin_test:\n    enable: true\n    filters:\n      - level: INFO\n        output: [console]\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadYamlFile(path); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	rr := serveAdmin(NewAdminHandler(), http.MethodPost, "/reload")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("POST /reload returned %d: %s", rr.Code, rr.Body)
+	}
+}
+
+func TestAdminMethodNotAllowed(t *testing.T) {
+	h := NewAdminHandler()
+	tests := []struct {
+		method string
+		target string
+	}{
+		{http.MethodPost, "/"},
+		{http.MethodGet, "/level?category=admin_test&level=DEBUG"},
+		{http.MethodGet, "/reload"},
+	}
+	for _, test := range tests {
+		if rr := serveAdmin(h, test.method, test.target); rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s returned %d, want %d", test.method, test.target, rr.Code, http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package log4g
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * 输出的实际写入操作，在异步队列的协程中依次调用
+ */
+type recordProcessor interface {
+	process(rec *FormattedRecord) bool // 写入失败时返回 false
+	sync() error                       // 将已经写入的内容同步到磁盘
+	close()
+}
+
+// 支持等待队列中的日志写入完成的输出
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// 支持重新打开文件的输出，外部工具(如 logrotate)移走文件后，重新打开以写入新的文件
+type Reopener interface {
+	Reopen() error
+}
+
+// 实际写入文件的 recordProcessor 实现此接口，在写入协程中调用
+type reopener interface {
+	reopen() error
+}
+
+// 支持限时关闭的输出，返回超时后丢弃的日志数量
+type contextCloser interface {
+	closeContext(ctx context.Context) int
+}
+
+// 队列中的元素，flushed 不为空时为刷新请求，处理到此位置时同步并通知请求方
+// reopen 为 true 时改为重新打开文件
+type queueItem struct {
+	rec     *FormattedRecord
+	flushed chan error
+	reopen  bool
+}
+
+type overflowPolicy int
+
+const (
+	kOverflowBlock          overflowPolicy = iota // 队列满时阻塞等待
+	kOverflowDropNewest                           // 丢弃新的日志
+	kOverflowDropOldest                           // 丢弃队列中最早的日志
+	kOverflowDropBelowLevel                       // 丢弃低于指定等级的新日志，其他日志阻塞等待
+)
+
+// 丢弃日志后，每隔多长时间检查一次队列压力是否缓解，缓解后输出一条丢弃数量的日志
+const kDroppedReportInterval = time.Second
+
+// 输出队列配置，嵌入到异步输出的配置中
+type queueSecCfg struct {
+	QueueSize     int    `json:"queue_size" yaml:"queue_size"`         // 队列长度，默认由输出类型决定
+	Overflow      string `json:"overflow" yaml:"overflow"`             // block|drop_newest|drop_oldest|drop_below_level, default is block
+	OverflowLevel string `json:"overflow_level" yaml:"overflow_level"` // drop_below_level 时低于此等级的日志会被丢弃，默认为 WARNING
+	Async         *bool  `json:"async" yaml:"async"`                   // 为 false 时在调用日志接口的协程中直接写入，默认为 true
+}
+
+var kOverflowPolicies = map[string]overflowPolicy{
+	"":                 kOverflowBlock,
+	"block":            kOverflowBlock,
+	"drop_newest":      kOverflowDropNewest,
+	"drop_oldest":      kOverflowDropOldest,
+	"drop_below_level": kOverflowDropBelowLevel,
+}
+
+// 检查队列配置，返回所有错误
+func (c *queueSecCfg) validate() []error {
+	var errs []error
+	if c.QueueSize < 0 {
+		errs = append(errs, optionErrorf("queue_size", "must not be negative"))
+	}
+	if _, ok := kOverflowPolicies[c.Overflow]; !ok {
+		errs = append(errs, optionErrorf("overflow", "unknown overflow %q", c.Overflow))
+	}
+	if _, ok := parseLevel(c.OverflowLevel); !ok && c.OverflowLevel != "" {
+		errs = append(errs, optionErrorf("overflow_level", "unknown level %q", c.OverflowLevel))
+	}
+	return errs
+}
+
+func newAsyncWriter(proc recordProcessor, cfg queueSecCfg, defaultSize int) (*asyncWriter, error) {
+	if errs := cfg.validate(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	w := &asyncWriter{
+		proc:          proc,
+		overflow:      kOverflowPolicies[cfg.Overflow],
+		overflowLevel: WARNING,
+		quit:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	if cfg.OverflowLevel != "" {
+		w.overflowLevel = strToLevel(cfg.OverflowLevel)
+	}
+
+	if cfg.Async != nil && !*cfg.Async {
+		w.inline = 1
+	}
+
+	size := defaultSize
+	if cfg.QueueSize > 0 {
+		size = cfg.QueueSize
+	}
+	w.ch = make(chan queueItem, size)
+
+	go w.run()
+	return w, nil
+}
+
+/**
+ * 异步输出，日志先放入队列，由单独的协程写入
+ * 同步模式下在调用者的协程中直接写入，进程崩溃或退出前已经返回的日志不会丢失
+ * 两种模式对 proc 的调用都持有 mu ，可以在运行时切换
+ */
+type asyncWriter struct {
+	dropped  uint64 // 队列满时丢弃的日志数量
+	reported uint64 // 已经输出过提示的丢弃数量，只在协程中访问
+	errors   uint64 // 写入失败的日志数量
+
+	proc recordProcessor
+	ch   chan queueItem
+
+	overflow      overflowPolicy
+	overflowLevel Level
+
+	quit      chan struct{} // 关闭时 close ，协程写完队列中剩余的日志后退出
+	done      chan struct{} // 协程退出后 close
+	closeOnce sync.Once
+	discard   int32 // 限时关闭超时后置为 1 ，协程丢弃剩余的日志
+
+	inline int32      // 为 1 时同步写入，需要原子访问
+	mu     sync.Mutex // 保护对 proc 的调用
+
+	reportLayouts atomic.Value // []*layoutInfo 输出丢弃提示所用的布局，每种布局类型一个
+}
+
+func (w *asyncWriter) Write(rec *FormattedRecord) {
+	select {
+	case <-w.quit:
+		rec.Release()
+		return
+	default:
+	}
+
+	if atomic.LoadInt32(&w.inline) != 0 {
+		w.writeInline(rec)
+		return
+	}
+
+	item := queueItem{rec: rec}
+	if w.overflow != kOverflowBlock {
+		select {
+		case w.ch <- item:
+			return
+		case <-w.quit:
+			rec.Release()
+			return
+		default:
+		}
+
+		// 队列已满
+		switch w.overflow {
+		case kOverflowDropNewest:
+			atomic.AddUint64(&w.dropped, 1)
+			rec.Release()
+			return
+		case kOverflowDropOldest:
+			w.replaceOldest(item)
+			return
+		case kOverflowDropBelowLevel:
+			if rec.Level < w.overflowLevel {
+				atomic.AddUint64(&w.dropped, 1)
+				rec.Release()
+				return
+			}
+		}
+	}
+
+	select {
+	case w.ch <- item:
+	case <-w.quit:
+		rec.Release()
+	}
+}
+
+// 同步写入，关闭后 proc 已经关闭，不再写入
+func (w *asyncWriter) writeInline(rec *FormattedRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	select {
+	case <-w.quit:
+		rec.Release()
+		return
+	default:
+	}
+	w.handleLocked(queueItem{rec: rec})
+}
+
+// 切换同步或异步模式，切换到同步模式时先写完队列中的日志
+func (w *asyncWriter) setAsync(async bool) {
+	if async {
+		atomic.StoreInt32(&w.inline, 0)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	atomic.StoreInt32(&w.inline, 1)
+	for {
+		select {
+		case item := <-w.ch:
+			w.handleLocked(item)
+		default:
+			return
+		}
+	}
+}
+
+// 丢弃队列中最早的日志，腾出位置放入 item ，刷新请求不会被丢弃，取出后重新放回队列
+func (w *asyncWriter) replaceOldest(item queueItem) {
+	for {
+		select {
+		case w.ch <- item:
+			return
+		case <-w.quit:
+			item.rec.Release()
+			return
+		default:
+		}
+
+		select {
+		case old := <-w.ch:
+			if old.flushed == nil {
+				atomic.AddUint64(&w.dropped, 1)
+				old.rec.Release()
+				continue
+			}
+			select {
+			case w.ch <- old:
+			case <-w.quit:
+				item.rec.Release()
+				return
+			}
+		default:
+		}
+	}
+}
+
+// 队列满时丢弃的日志数量
+func (w *asyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// 写入失败的日志数量
+func (w *asyncWriter) Errors() uint64 {
+	return atomic.LoadUint64(&w.errors)
+}
+
+// 队列中等待写入的数量和队列长度
+func (w *asyncWriter) QueueDepth() (int, int) {
+	return len(w.ch), cap(w.ch)
+}
+
+// 等待在此之前放入队列的日志全部写入并同步到磁盘
+func (w *asyncWriter) Flush(ctx context.Context) error {
+	if atomic.LoadInt32(&w.inline) != 0 {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return w.proc.sync()
+	}
+
+	item := queueItem{flushed: make(chan error, 1)}
+
+	select {
+	case w.ch <- item:
+	case <-w.quit:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-item.flushed:
+		return err
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 在写入协程中重新打开文件，队列中已有的日志写入原来的文件，之后的写入新的文件
+func (w *asyncWriter) Reopen() error {
+	if _, ok := w.proc.(reopener); !ok {
+		return nil
+	}
+
+	if atomic.LoadInt32(&w.inline) != 0 {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return w.proc.(reopener).reopen()
+	}
+
+	item := queueItem{flushed: make(chan error, 1), reopen: true}
+	select {
+	case w.ch <- item:
+	case <-w.quit:
+		return nil
+	}
+
+	select {
+	case err := <-item.flushed:
+		return err
+	case <-w.done:
+		return nil
+	}
+}
+
+func (w *asyncWriter) Close() {
+	w.closeContext(context.Background())
+}
+
+func (w *asyncWriter) closeContext(ctx context.Context) int {
+	w.closeOnce.Do(func() {
+		close(w.quit)
+	})
+
+	select {
+	case <-w.done:
+		return 0
+	case <-ctx.Done():
+		atomic.StoreInt32(&w.discard, 1)
+		return len(w.ch)
+	}
+}
+
+func (w *asyncWriter) run() {
+	defer close(w.done)
+	defer func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.proc.close()
+	}()
+
+	ticker := time.NewTicker(kDroppedReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case item := <-w.ch:
+			w.handle(item)
+		case <-ticker.C:
+			w.reportDropped()
+		case <-w.quit:
+			for {
+				select {
+				case item := <-w.ch:
+					w.handle(item)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (w *asyncWriter) handle(item queueItem) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handleLocked(item)
+}
+
+func (w *asyncWriter) handleLocked(item queueItem) {
+	defer doRecover()
+
+	if item.flushed != nil {
+		if item.reopen {
+			item.flushed <- w.proc.(reopener).reopen()
+		} else {
+			item.flushed <- w.proc.sync()
+		}
+		return
+	}
+
+	defer item.rec.Release()
+
+	if atomic.LoadInt32(&w.discard) != 0 {
+		return
+	}
+	if !w.proc.process(item.rec) {
+		atomic.AddUint64(&w.errors, 1)
+	}
+}
+
+// 设置丢弃提示所用的布局，即写入此输出的过滤器的布局，每种布局类型只保留第一个
+// 使 json 、 logfmt 等输出中的提示也是合法的一行
+func (w *asyncWriter) setReportLayouts(layouts []*layoutInfo) {
+	w.reportLayouts.Store(layouts)
+}
+
+// 有新丢弃的日志，并且队列使用不到一半时，认为压力已经缓解，输出一条丢弃数量的日志
+// 按写入此输出的每种布局类型各输出一条，没有设置布局时使用默认布局
+func (w *asyncWriter) reportDropped() {
+	dropped := atomic.LoadUint64(&w.dropped)
+	if dropped == w.reported || len(w.ch) > cap(w.ch)/2 {
+		return
+	}
+
+	layouts, _ := w.reportLayouts.Load().([]*layoutInfo)
+	if len(layouts) == 0 {
+		layouts = []*layoutInfo{gDefaultLayout}
+	}
+
+	rec := &logRecord{
+		Category: "log4g",
+		Level:    WARNING,
+		Created:  time.Now(),
+		Message:  fmt.Sprintf("%d records dropped, queue is full", dropped-w.reported),
+	}
+	for _, layout := range layouts {
+		w.handle(queueItem{rec: formatRecord(rec, layout, 1)})
+	}
+	w.reported = dropped
+}
+
+// 输出使用的写入队列，控制台输出为它使用的流，不是异步输出时返回 nil
+func queueWriters(w Writer) []*asyncWriter {
+	switch w := w.(type) {
+	case *asyncWriter:
+		return []*asyncWriter{w}
+	case *consoleOutput:
+		return w.streams()
+	}
+	return nil
+}
+
+// 限时关闭输出，返回超时后丢弃的日志数量，不支持限时关闭的输出超时后不再等待
+func closeWriter(ctx context.Context, w Writer) int {
+	if c, ok := w.(contextCloser); ok {
+		return c.closeContext(ctx)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer doRecover()
+		w.Close()
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	return 0
+}
@@ -0,0 +1,231 @@
+package log4g
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const kBlockedWriterType = "test_blocked"
+
+// 测试用的输出，第一条日志阻塞到 release 被关闭，记录写入的每一行
+type blockingProcessor struct {
+	started   chan struct{}
+	release   chan struct{}
+	processed int32
+
+	mu    sync.Mutex
+	lines []string
+}
+
+func newBlockingProcessor() *blockingProcessor {
+	return &blockingProcessor{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+}
+
+func (p *blockingProcessor) process(rec *FormattedRecord) bool {
+	if atomic.AddInt32(&p.processed, 1) == 1 {
+		close(p.started)
+		<-p.release
+	}
+
+	p.mu.Lock()
+	p.lines = append(p.lines, string(rec.line()))
+	p.mu.Unlock()
+	return true
+}
+
+func (p *blockingProcessor) getLines() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.lines...)
+}
+
+func (p *blockingProcessor) sync() error {
+	return nil
+}
+
+func (p *blockingProcessor) close() {
+}
+
+var gBlockedWriter *asyncWriter // test_blocked 类型最近创建的输出
+
+func init() {
+	RegisterWriterType(kBlockedWriterType, func(_ string, _ map[string]interface{}) (Writer, error) {
+		w, err := newAsyncWriter(newBlockingProcessor(), queueSecCfg{}, 16)
+		gBlockedWriter = w
+		return w, err
+	})
+}
+
+func writeLine(w Writer, line string) {
+	rec := getFormattedRecord(time.Now(), INFO, "test", 1)
+	rec.setLine(append(rec.buf, line+"\n"...))
+	w.Write(rec)
+}
+
+func TestFlushWritesQueuedRecords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := newFileLogWriter(fileSecCfg{Filename: filepath.Join(dir, "flush")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	const n = 1000
+	for i := 0; i < n; i++ {
+		writeLine(w, "flush test")
+	}
+	if err := w.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "flush.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(content, []byte("flush test\n")); lines != n {
+		t.Fatalf("got %d lines on disk after Flush, want %d", lines, n)
+	}
+}
+
+func TestFlushWaitsForProcessor(t *testing.T) {
+	proc := newBlockingProcessor()
+	w, err := newAsyncWriter(proc, queueSecCfg{}, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for i := 0; i < 3; i++ {
+		writeLine(w, "x")
+	}
+	<-proc.started
+
+	flushed := make(chan error, 1)
+	go func() {
+		flushed <- w.Flush(context.Background())
+	}()
+
+	select {
+	case err := <-flushed:
+		t.Fatalf("Flush returned %v while the processor is blocked", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(proc.release)
+	if err := <-flushed; err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if n := atomic.LoadInt32(&proc.processed); n != 3 {
+		t.Fatalf("processed %d records before Flush returned, want 3", n)
+	}
+}
+
+func TestFlushTimeout(t *testing.T) {
+	proc := newBlockingProcessor()
+	w, err := newAsyncWriter(proc, queueSecCfg{}, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	defer close(proc.release)
+
+	writeLine(w, "x")
+	<-proc.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := w.Flush(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Flush returned %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestCloseWithTimeoutBlocked(t *testing.T) {
+	err := LoadJsonString(`{
+		"files": {"blocked": {"type": "test_blocked"}},
+		"categories": {"close_test": {"enable": true, "filters": [{"output": ["blocked"]}]}}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := gBlockedWriter
+	proc := w.proc.(*blockingProcessor)
+
+	l := GetLogger("close_test")
+	for i := 0; i < 5; i++ {
+		l.Info("x")
+	}
+	<-proc.started // 第一条已经取出，其余 4 条在队列中
+
+	dropped, err := CloseWithTimeout(50 * time.Millisecond)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("CloseWithTimeout returned %v, want %v", err, context.DeadlineExceeded)
+	}
+	if dropped != 4 {
+		t.Fatalf("CloseWithTimeout dropped %d, want 4", dropped)
+	}
+
+	close(proc.release)
+	select {
+	case <-w.done:
+	case <-time.After(time.Second):
+		t.Fatal("writer did not exit after the processor was released")
+	}
+	if n := atomic.LoadInt32(&proc.processed); n != 1 {
+		t.Fatalf("processed %d records, want 1, the rest are discarded", n)
+	}
+}
+
+func TestDroppedReportUsesLayout(t *testing.T) {
+	proc := newBlockingProcessor()
+	w, err := newAsyncWriter(proc, queueSecCfg{QueueSize: 1, Overflow: "drop_newest"}, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	layout, err := newLayoutFromCfg(layoutSecCfg{Type: kJsonLayoutType})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.setReportLayouts([]*layoutInfo{layout})
+
+	writeLine(w, `{"msg":"x"}`)
+	<-proc.started
+	for i := 0; i < 4; i++ {
+		writeLine(w, `{"msg":"x"}`) // 第一条放入队列，其余丢弃
+	}
+	close(proc.release)
+
+	deadline := time.Now().Add(3 * kDroppedReportInterval)
+	for time.Now().Before(deadline) {
+		lines := proc.getLines()
+		if len(lines) == 3 {
+			var report map[string]interface{}
+			if err := json.Unmarshal([]byte(lines[2]), &report); err != nil {
+				t.Fatalf("report %q is not json: %v", lines[2], err)
+			}
+			if msg := report["message"]; msg != "3 records dropped, queue is full" {
+				t.Fatalf("report message %v", msg)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no dropped report, lines %q", proc.getLines())
+}
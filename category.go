@@ -1,121 +1,315 @@
 package log4g
 
 import (
+	"context"
 	"fmt"
+	"sync/atomic"
 	"time"
 )
 
-func newDefaultCategory(name string) Logger {
-	return &category{
-		category: name,
-		extSkip:  0,
-		filters: []*categoryFilter{
-			{
-				category: name,
-				level:    DEBUG,
-				writers: []logWriter{
-					gSingleConsoleWriter,
-				},
-				layout: gDefaultLayout,
-			},
-		},
+// 正在使用某个配置对象的日志调用数量，重新加载配置后等待归零，才能关闭不再使用的输出
+type inflight int32
+
+func (n *inflight) enter() {
+	atomic.AddInt32((*int32)(n), 1)
+}
+
+func (n *inflight) leave() {
+	atomic.AddInt32((*int32)(n), -1)
+}
+
+// 等待所有日志调用完成，ctx 结束时不再等待
+func waitInflight(ctx context.Context, list []*inflight) {
+	for _, n := range list {
+		for atomic.LoadInt32((*int32)(n)) > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+}
+
+// 分类的过滤器，以及所有过滤器的布局需要的日志源信息，重新加载配置时整体替换
+type filterSet struct {
+	filters []*categoryFilter
+	needs   sourceNeeds
+	active  inflight // 正在通过此过滤器输出的日志调用
+}
+
+// 是否有过滤器会输出 level 等级的日志
+func (set *filterSet) isEnabled(level Level) bool {
+	for _, f := range set.filters {
+		if len(f.writers) > 0 && level >= f.getLevel() {
+			return true
+		}
 	}
+	return false
+}
+
+// 没有设置过滤器的分类使用的空过滤器
+var gEmptyFilterSet = &filterSet{}
+
+func newFilterSet(filters []*categoryFilter) *filterSet {
+	set := &filterSet{filters: filters}
+	for _, f := range filters {
+		if f.layout != nil {
+			set.needs |= f.layout.Needs
+		}
+	}
+	return set
 }
 
 /**
  * 日志分类，继承自 Logger ，并包含多个过滤器
  */
 type category struct {
-	category string            // 分类名称
-	extSkip  int               // 如果外部增加调用层级，就需要使用这个值来修正源代码位置
-	filters  []*categoryFilter // 过滤器，日志输出最终会进入到过滤器中，然后过滤器再送到各个输出对象中
+	category string       // 分类名称
+	extSkip  int          // 如果外部增加调用层级，就需要使用这个值来修正源代码位置
+	filters  atomic.Value // *filterSet 过滤器，日志输出最终会进入到过滤器中，然后过滤器再送到各个输出对象中
+	minLevel int32        // 所有过滤器中最低的等级，低于此等级的日志不需要格式化
+	parent   *category    // With 创建的子分类指向注册在 gLoggerMgr 中的分类，过滤器从 parent 获取
+	fields   []field      // With 添加的结构化字段
+}
+
+func (c *category) getFilterSet() *filterSet {
+	if c.parent != nil {
+		return c.parent.getFilterSet()
+	}
+	set, _ := c.filters.Load().(*filterSet)
+	if set == nil {
+		return gEmptyFilterSet
+	}
+	return set
+}
+
+// 获取过滤器用于输出日志，输出完成后调用 set.active.leave()
+// 增加计数后过滤器已被替换时重新获取，保证重新加载配置时能等到所有使用旧过滤器的调用完成
+func (c *category) acquireFilterSet() *filterSet {
+	if c.parent != nil {
+		return c.parent.acquireFilterSet()
+	}
+	for {
+		set := c.getFilterSet()
+		set.active.enter()
+		if cur, _ := c.filters.Load().(*filterSet); cur == set || cur == nil {
+			return set
+		}
+		set.active.leave()
+	}
+}
+
+func (c *category) getFilters() []*categoryFilter {
+	return c.getFilterSet().filters
+}
+
+// 重新加载配置时整体替换过滤器，已经通过 GetLogger 获取的对象无需重新获取
+// 返回替换前的过滤器，没有时返回 nil
+func (c *category) setFilters(filters []*categoryFilter) *filterSet {
+	old, _ := c.filters.Load().(*filterSet)
+	c.filters.Store(newFilterSet(filters))
+	c.updateMinLevel()
+	return old
+}
+
+// 过滤器或过滤器的等级变化后重新计算最低等级，没有过滤器或过滤器都没有输出时高于所有等级
+func (c *category) updateMinLevel() {
+	level := CRITICAL + 1
+	for _, f := range c.getFilters() {
+		if len(f.writers) == 0 {
+			continue
+		}
+		if l := f.getLevel(); l < level {
+			level = l
+		}
+	}
+	atomic.StoreInt32(&c.minLevel, int32(level))
+}
+
+func (c *category) IsEnabled(level Level) bool {
+	if c.parent != nil {
+		return c.parent.IsEnabled(level)
+	}
+	return int32(level) >= atomic.LoadInt32(&c.minLevel)
 }
 
 func (c *category) Critical(args ...interface{}) {
-	c.internalLog(CRITICAL, fmt.Sprint(args...))
+	if !c.IsEnabled(CRITICAL) {
+		return
+	}
+	c.internalLog(CRITICAL, sprint(args))
 }
 func (c *category) CriticalF(format string, args ...interface{}) {
+	if !c.IsEnabled(CRITICAL) {
+		return
+	}
 	c.internalLog(CRITICAL, fmt.Sprintf(format, args...))
 }
+func (c *category) CriticalFn(fn func() string) {
+	if !c.IsEnabled(CRITICAL) {
+		return
+	}
+	c.internalLog(CRITICAL, fn())
+}
 
 func (c *category) Error(args ...interface{}) {
-	c.internalLog(ERROR, fmt.Sprint(args...))
+	if !c.IsEnabled(ERROR) {
+		return
+	}
+	c.internalLog(ERROR, sprint(args))
 }
 func (c *category) ErrorF(format string, args ...interface{}) {
+	if !c.IsEnabled(ERROR) {
+		return
+	}
 	c.internalLog(ERROR, fmt.Sprintf(format, args...))
 }
+func (c *category) ErrorFn(fn func() string) {
+	if !c.IsEnabled(ERROR) {
+		return
+	}
+	c.internalLog(ERROR, fn())
+}
 
 func (c *category) Warn(args ...interface{}) {
-	c.internalLog(WARNING, fmt.Sprint(args...))
+	if !c.IsEnabled(WARNING) {
+		return
+	}
+	c.internalLog(WARNING, sprint(args))
 }
 func (c *category) WarnF(format string, args ...interface{}) {
+	if !c.IsEnabled(WARNING) {
+		return
+	}
 	c.internalLog(WARNING, fmt.Sprintf(format, args...))
 }
+func (c *category) WarnFn(fn func() string) {
+	if !c.IsEnabled(WARNING) {
+		return
+	}
+	c.internalLog(WARNING, fn())
+}
 
 func (c *category) Info(args ...interface{}) {
-	c.internalLog(INFO, fmt.Sprint(args...))
+	if !c.IsEnabled(INFO) {
+		return
+	}
+	c.internalLog(INFO, sprint(args))
 }
 func (c *category) InfoF(format string, args ...interface{}) {
+	if !c.IsEnabled(INFO) {
+		return
+	}
 	c.internalLog(INFO, fmt.Sprintf(format, args...))
 }
+func (c *category) InfoFn(fn func() string) {
+	if !c.IsEnabled(INFO) {
+		return
+	}
+	c.internalLog(INFO, fn())
+}
 
 func (c *category) Debug(args ...interface{}) {
-	c.internalLog(DEBUG, fmt.Sprint(args...))
+	if !c.IsEnabled(DEBUG) {
+		return
+	}
+	c.internalLog(DEBUG, sprint(args))
 }
 func (c *category) DebugF(format string, args ...interface{}) {
+	if !c.IsEnabled(DEBUG) {
+		return
+	}
 	c.internalLog(DEBUG, fmt.Sprintf(format, args...))
 }
+func (c *category) DebugFn(fn func() string) {
+	if !c.IsEnabled(DEBUG) {
+		return
+	}
+	c.internalLog(DEBUG, fn())
+}
 
 func (c *category) Trace(args ...interface{}) {
-	c.internalLog(TRACE, fmt.Sprint(args...))
+	if !c.IsEnabled(TRACE) {
+		return
+	}
+	c.internalLog(TRACE, sprint(args))
 }
 func (c *category) TraceF(format string, args ...interface{}) {
+	if !c.IsEnabled(TRACE) {
+		return
+	}
 	c.internalLog(TRACE, fmt.Sprintf(format, args...))
 }
+func (c *category) TraceFn(fn func() string) {
+	if !c.IsEnabled(TRACE) {
+		return
+	}
+	c.internalLog(TRACE, fn())
+}
 
 func (c *category) Log(level Level, args ...interface{}) {
-	c.internalLog(level, fmt.Sprint(args...))
+	if !c.IsEnabled(level) {
+		return
+	}
+	c.internalLog(level, sprint(args))
 }
 func (c *category) LogF(level Level, format string, args ...interface{}) {
+	if !c.IsEnabled(level) {
+		return
+	}
 	c.internalLog(level, fmt.Sprintf(format, args...))
 }
+func (c *category) LogFn(level Level, fn func() string) {
+	if !c.IsEnabled(level) {
+		return
+	}
+	c.internalLog(level, fn())
+}
+
+func (c *category) With(kv ...interface{}) Logger {
+	parent := c
+	if c.parent != nil {
+		parent = c.parent
+	}
+
+	return &category{
+		category: c.category,
+		extSkip:  c.extSkip,
+		parent:   parent,
+		fields:   appendFields(c.fields, kv),
+	}
+}
+
+// 只有一个字符串参数时直接使用，避免 fmt.Sprint 复制
+func sprint(args []interface{}) string {
+	if len(args) == 1 {
+		if s, ok := args[0].(string); ok {
+			return s
+		}
+	}
+	return fmt.Sprint(args...)
+}
 
 func (c *category) internalLog(level Level, msg string) {
+	set := c.acquireFilterSet()
+	defer set.active.leave()
+
 	rec := &logRecord{
 		Category: c.category,
 		Level:    level,
 		Created:  time.Now(),
 		Message:  msg,
-		Source:   getSource(3 + c.extSkip),
+		Source:   getSource(3+c.extSkip, set.needs),
+		Fields:   c.fields,
 	}
 
-	for _, filter := range c.filters {
-		filter.logMessage(rec)
-	}
+	set.dispatch(rec)
 }
 
-func (c *category) internalAddFilter(cfg categoryFilterCfg, writers map[string]logWriter,
-	layouts map[string]*layoutInfo) error {
-	layout, ok := layouts[cfg.Layout]
-	if !ok {
-		return fmt.Errorf("layout not found in layouts config")
-	}
-
-	filter := newFilter(c.category, strToLevel(cfg.Level), layout)
-	for _, output := range cfg.Output {
-		var writer logWriter
-		if output == "console" {
-			writer = gSingleConsoleWriter
-		} else {
-			var ok bool
-			writer, ok = writers[output]
-			if !ok {
-				return fmt.Errorf("output not found in files config")
-			}
-		}
-		filter.writers = append(filter.writers, writer)
+// 将日志送到所有过滤器，记录中的日志源信息需要按 needs 获取
+func (set *filterSet) dispatch(rec *logRecord) {
+	for _, filter := range set.filters {
+		filter.logMessage(rec)
 	}
-
-	c.filters = append(c.filters, filter)
-	return nil
 }
@@ -1,12 +1,15 @@
 package log4g
 
-import "fmt"
+import (
+	"fmt"
+	"sync/atomic"
+)
 
 func newFilter(category string, level Level, layout *layoutInfo) *categoryFilter {
 	filter := &categoryFilter{
 		category: category,
-		level:    level,
-		writers:  make([]logWriter, 0),
+		level:    int32(level),
+		writers:  make([]Writer, 0),
 		layout:   layout,
 	}
 	return filter
@@ -14,11 +17,26 @@ func newFilter(category string, level Level, layout *layoutInfo) *categoryFilter
 
 type categoryFilter struct {
 	category string
-	level    Level
-	writers  []logWriter
+	name     string // 可选的名称，用于运行时修改等级
+	level    int32  // Level ，运行时可以修改，需要原子访问
+	writers  []Writer
+	outputs  []string // 与 writers 对应的输出名称
 	layout   *layoutInfo
 }
 
+func (f *categoryFilter) addWriter(output string, w Writer) {
+	f.writers = append(f.writers, w)
+	f.outputs = append(f.outputs, output)
+}
+
+func (f *categoryFilter) getLevel() Level {
+	return Level(atomic.LoadInt32(&f.level))
+}
+
+func (f *categoryFilter) setLevel(level Level) {
+	atomic.StoreInt32(&f.level, int32(level))
+}
+
 func (f *categoryFilter) logMessage(rec *logRecord) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -26,16 +44,25 @@ func (f *categoryFilter) logMessage(rec *logRecord) {
 		}
 	}()
 
-	if rec.Level < f.level {
+	if rec.Level < f.getLevel() {
 		return
 	}
 
-	fr := &formattedRecord{
-		Created: rec.Created,
-		Formatted: recordFormatToString(rec, f.layout),
+	if len(f.writers) == 0 {
+		return
 	}
 
+	fr := formatRecord(rec, f.layout, len(f.writers))
 	for _, writer := range f.writers {
 		writer.Write(fr)
 	}
 }
+
+// 格式化到缓存池的缓冲区中，每个输出写入完成后调用 Release ，refs 次后放回缓存池
+func formatRecord(rec *logRecord, layout *layoutInfo, refs int) *FormattedRecord {
+	fr := getFormattedRecord(rec.Created, rec.Level, rec.Category, refs)
+	buf, spans := appendRecord(fr.buf, fr.spans, rec, layout)
+	fr.spans = spans
+	fr.setLine(append(buf, '\n'))
+	return fr
+}
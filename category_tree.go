@@ -0,0 +1,154 @@
+package log4g
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 根分类的名称，没有配置根分类时使用全局段中的默认配置
+const kRootCategory = "root"
+
+// 每个分类树最多缓存的未注册分类的过滤器数量
+const kMaxRoutedCategories = 1024
+
+// 当前配置中的分类，日志输出时原子读取，替换时持有 gLoggerMu
+var gCategoryTree = func() *atomic.Value {
+	v := &atomic.Value{}
+	v.Store(newCategoryTree())
+	return v
+}()
+
+func currentCategoryTree() *categoryTree {
+	return gCategoryTree.Load().(*categoryTree)
+}
+
+// 获取当前的分类树用于输出未注册分类的日志，输出完成后调用 t.active.leave()
+// 增加计数后分类树已被替换时重新获取，重新加载配置时等待计数归零再关闭不再使用的输出
+func acquireCategoryTree() *categoryTree {
+	for {
+		t := currentCategoryTree()
+		t.active.enter()
+		if currentCategoryTree() == t {
+			return t
+		}
+		t.active.leave()
+	}
+}
+
+func newCategoryTree() *categoryTree {
+	return &categoryTree{
+		filters:    map[string][]*categoryFilter{},
+		additivity: map[string]bool{},
+		defaults: defaultFilterCfg{
+			level:   DEBUG,
+			layout:  gDefaultLayout,
+			outputs: []string{kConsoleOutput},
+			writers: []Writer{gConsoleOutput},
+		},
+	}
+}
+
+// 既没有配置分类，也没有配置根分类时使用的过滤器配置，来自全局段，默认 DEBUG 级别输出到控制台
+type defaultFilterCfg struct {
+	level   Level
+	layout  *layoutInfo
+	outputs []string
+	writers []Writer // 与 outputs 对应
+}
+
+/**
+ * 配置中的分类按名称中的 '.' 组成层级，如 db 是 db.pool 的父分类
+ * 分类使用最近的已配置的祖先(包括自己)的过滤器，都没有时使用根分类的过滤器
+ * 已配置的分类设置了 additivity 时，它的父分类的过滤器也会收到日志，直到根分类
+ */
+type categoryTree struct {
+	filters    map[string][]*categoryFilter // 配置中每个分类自己的过滤器
+	additivity map[string]bool
+	defaults   defaultFilterCfg
+
+	routed      sync.Map // 分类名 -> *filterSet ，未注册分类的过滤器，随分类树一起替换
+	routedCount int32    // routed 中的数量，达到 kMaxRoutedCategories 后不再缓存
+	active      inflight // 正在通过此分类树输出未注册分类的日志调用
+}
+
+// 计算分类实际使用的过滤器
+func (t *categoryTree) resolve(name string) []*categoryFilter {
+	var filters []*categoryFilter
+	for n := name; ; {
+		if fs, ok := t.filters[n]; ok && n != kRootCategory {
+			filters = append(filters, fs...)
+			if !t.additivity[n] {
+				return filters
+			}
+		}
+
+		idx := strings.LastIndexByte(n, '.')
+		if idx < 0 {
+			break
+		}
+		n = n[:idx]
+	}
+
+	if fs, ok := t.filters[kRootCategory]; ok {
+		return append(filters, fs...)
+	}
+	return append(filters, t.newDefaultFilter(name))
+}
+
+// 计算未注册分类的过滤器，不注册分类，用于 SlogHandler 按属性值路由等分类名称不固定的场景
+// 结果缓存在分类树中，数量有上限，超出后每次重新计算
+func (t *categoryTree) resolveRouted(name string) *filterSet {
+	if set, ok := t.routed.Load(name); ok {
+		return set.(*filterSet)
+	}
+
+	set := newFilterSet(t.resolve(name))
+	if atomic.LoadInt32(&t.routedCount) < kMaxRoutedCategories {
+		if actual, loaded := t.routed.LoadOrStore(name, set); loaded {
+			return actual.(*filterSet)
+		}
+		atomic.AddInt32(&t.routedCount, 1)
+	}
+	return set
+}
+
+func (t *categoryTree) newDefaultFilter(name string) *categoryFilter {
+	filter := newFilter(name, t.defaults.level, t.defaults.layout)
+	for i, w := range t.defaults.writers {
+		filter.addWriter(t.defaults.outputs[i], w)
+	}
+	return filter
+}
+
+// 每个写入队列的丢弃提示所用的布局，来自写入它的所有过滤器，每种布局类型只保留第一个
+func (t *categoryTree) reportLayouts() map[*asyncWriter][]*layoutInfo {
+	layouts := map[*asyncWriter][]*layoutInfo{}
+	add := func(writers []Writer, layout *layoutInfo) {
+		if layout == nil {
+			return
+		}
+		for _, w := range writers {
+			for _, q := range queueWriters(w) {
+				found := false
+				for _, l := range layouts[q] {
+					if l.layoutType() == layout.layoutType() {
+						found = true
+						break
+					}
+				}
+				if !found {
+					layouts[q] = append(layouts[q], layout)
+				}
+			}
+		}
+	}
+
+	for _, filters := range t.filters {
+		for _, f := range filters {
+			add(f.writers, f.layout)
+		}
+	}
+	add(t.defaults.writers, t.defaults.layout)
+	return layouts
+}
@@ -0,0 +1,78 @@
+package log4g
+
+import (
+	"strings"
+	"testing"
+)
+
+// 过滤器所属的分类名称，按顺序用 ',' 连接
+func filterOwners(filters []*categoryFilter) string {
+	var owners []string
+	for _, f := range filters {
+		owners = append(owners, f.category)
+	}
+	return strings.Join(owners, ",")
+}
+
+func newTestTree(additivity map[string]bool, names ...string) *categoryTree {
+	tree := newCategoryTree()
+	for _, name := range names {
+		tree.filters[name] = []*categoryFilter{newFilter(name, INFO, gDefaultLayout)}
+		tree.additivity[name] = additivity[name]
+	}
+	return tree
+}
+
+func TestCategoryTreeResolve(t *testing.T) {
+	tree := newTestTree(map[string]bool{"app.db": true, "app.db.pool": true},
+		"root", "app", "app.db", "app.db.pool", "app.http", "other.x")
+
+	tests := []struct {
+		name   string
+		owners string
+	}{
+		{"app", "app"},
+		{"app.cache", "app"},                           // 使用最近的已配置祖先
+		{"app.http.client", "app.http"},                // 没有 additivity 时不向上传递
+		{"app.db", "app.db,app"},                       // additivity 时父分类也收到日志
+		{"app.db.pool", "app.db.pool,app.db,app"},      // additivity 沿着链一直传递
+		{"app.db.pool.conn", "app.db.pool,app.db,app"}, // 从最近的已配置祖先开始
+		{"other", "root"},                              // 只有子分类配置时使用根分类
+		{"other.x.y", "other.x"},
+		{"unknown", "root"},
+		{"root", "root"},
+	}
+	for _, test := range tests {
+		if got := filterOwners(tree.resolve(test.name)); got != test.owners {
+			t.Errorf("resolve(%s) = %s, want %s", test.name, got, test.owners)
+		}
+	}
+}
+
+// additivity 传递到最顶层的已配置分类后，继续传递到根分类
+func TestCategoryTreeResolveAdditivityToRoot(t *testing.T) {
+	tree := newTestTree(map[string]bool{"app": true, "app.db": true}, "root", "app", "app.db")
+	if got, want := filterOwners(tree.resolve("app.db.pool")), "app.db,app,root"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+// 没有配置根分类时使用全局段的默认配置
+func TestCategoryTreeResolveDefaults(t *testing.T) {
+	tree := newTestTree(map[string]bool{"app": true}, "app")
+	tree.defaults.level = WARNING
+
+	filters := tree.resolve("payments")
+	if len(filters) != 1 {
+		t.Fatalf("got %d filters, want 1", len(filters))
+	}
+	f := filters[0]
+	if f.category != "payments" || f.getLevel() != WARNING || f.layout != gDefaultLayout ||
+		len(f.outputs) != 1 || f.outputs[0] != kConsoleOutput {
+		t.Fatalf("unexpected default filter %+v", f)
+	}
+
+	if got, want := filterOwners(tree.resolve("app.db")), "app,app.db"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
@@ -1,15 +1,23 @@
 package log4g
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/go-yaml/yaml"
 	"github.com/toolkits/file"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
 )
 
-// 全局段配置
+// 全局段配置，level 、 layout 和 output 用于没有配置的分类，配置了 root 分类时使用 root 分类
 type globalSecCfg struct {
-	ConsoleEnable bool `json:"console_enable" yaml:"console_enable"`
+	ConsoleEnable *bool    `json:"console_enable" yaml:"console_enable"` // 为 false 时所有控制台输出(包括 stderr)都不输出，default is true
+	Level         string   `json:"level" yaml:"level"`                   // default is DEBUG
+	Layout        string   `json:"layout" yaml:"layout"`                 // layout name, default is "default"
+	Output        []string `json:"output" yaml:"output"`                 // default is [console]
 }
 
 // 文件段配置
@@ -19,97 +27,287 @@ type fileSecCfg struct {
 	Maxsize  string `json:"maxsize" yaml:"maxsize"` // \d+[KMG]? Suffixes are in terms of 2**10, default is "10M"
 	Maxline  string `json:"maxline" yaml:"maxline"` // \d+[KMG]? Suffixes are in terms of thousands, default is "100K"
 	Daily    bool   `json:"daily" yaml:"daily"`     // Automatically rotates by day, default is true
+
+	MaxBackups int    `json:"max_backups" yaml:"max_backups"` // 保留的轮转文件数量，默认为 0 不限制
+	MaxAge     string `json:"max_age" yaml:"max_age"`         // \d+[smhd] 轮转文件保留的时间，默认为空不限制，eg. 7d
+	Compress   string `json:"compress" yaml:"compress"`       // 轮转文件的压缩方式，目前只支持 gzip ，默认为空不压缩
+
+	queueSecCfg `yaml:",inline"` // 队列配置，默认长度为 32
+}
+
+// 输出段配置，type 指定输出类型，默认为 file ，其余配置项由对应类型的 WriterFactory 解析
+type outputSecCfg map[string]interface{}
+
+func (c outputSecCfg) Type() string {
+	if t, ok := c["type"].(string); ok && t != "" {
+		return t
+	}
+	return kFileWriterType
+}
+
+// 布局段配置，可以直接写成格式字符串，也可以写成对象指定布局类型
+//
+//	simple: '[%T] %L %C (%S) %M'
+//	index:
+//	  type: json
+//	  time_format: '2006-01-02T15:04:05.000Z07:00'
+//	  fields: { time: ts, message: msg, thread: '-' }
+type layoutSecCfg struct {
+	Type       string            `json:"type" yaml:"type"`               // text, json or logfmt, default is text
+	Pattern    string            `json:"pattern" yaml:"pattern"`         // text 布局的格式字符串
+	TimeFormat string            `json:"time_format" yaml:"time_format"` // json 和 logfmt 布局的时间格式，默认为 RFC3339 精确到毫秒
+	Fields     map[string]string `json:"fields" yaml:"fields"`           // json 布局的字段名，值为 '-' 时不输出该字段，见 kJsonKeys
+}
+
+func (c *layoutSecCfg) UnmarshalJSON(data []byte) error {
+	var pattern string
+	if err := json.Unmarshal(data, &pattern); err == nil {
+		*c = layoutSecCfg{Pattern: pattern}
+		return nil
+	}
+
+	type plain layoutSecCfg
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+func (c *layoutSecCfg) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var pattern string
+	if err := unmarshal(&pattern); err == nil {
+		*c = layoutSecCfg{Pattern: pattern}
+		return nil
+	}
+
+	type plain layoutSecCfg
+	return unmarshal((*plain)(c))
 }
 
 // 日志分类段配置
+// 分类名称中的 '.' 表示层级，没有配置的分类使用最近的已配置的父分类，都没有时使用 root 分类
 type categorySecCfg struct {
-	Enable  bool                `json:"enable" yaml:"enable"` // default is false
-	Filters []categoryFilterCfg `json:"filters" yaml:"filters"`
+	Enable     bool                `json:"enable" yaml:"enable"`         // default is false
+	Additivity bool                `json:"additivity" yaml:"additivity"` // 父分类的过滤器也会收到日志，default is false
+	Filters    []categoryFilterCfg `json:"filters" yaml:"filters"`
 }
 
 // 日志分类下的过滤器配置
 type categoryFilterCfg struct {
+	Name   string   `json:"name" yaml:"name"`     // optional, used by SetFilterLevel
 	Level  string   `json:"level" yaml:"level"`   // default is DEBUG
-	Layout string   `json:"layout" yaml:"layout"` // layout name
+	Layout string   `json:"layout" yaml:"layout"` // layout name, default is "default"
 	Output []string `json:"output" yaml:"output"` // output to console and files
 }
 
 // 完整配置
 type fullConfig struct {
-	Global globalSecCfg          `json:"global" yaml:"global"`
-	Files  map[string]fileSecCfg `json:"files" yaml:"files"`
-
-	/// TODO: 每个分段后面可以通过 {} 增加格式参数
-
-	// Known format codes:
-	// %T - DateTime with format string, default format is (2006-01-03 15:04:05.000)
-	//  	eg. %T{2006-01-02 15:04:05}
-	// %L - Level (DEBG, TRAC, WARN, EROR, CRIT)
-	// %l - Level (D, T, W, E, C)
-	// %C - category
-	// %S - Source
-	// %M - Message
-	// Ignores unknown formats
-	// Recommended: "[%T] %level %C (%S) %M"
-	// 		if config is invalid, will be replaced with default value
-	Layouts    map[string]string         `json:"layouts" yaml:"layouts"` // default is "[%T] %level %C (%S) %M"
+	Global globalSecCfg            `json:"global" yaml:"global"`
+	Files  map[string]outputSecCfg `json:"files" yaml:"files"`
+
+	// 布局，格式字符串见 newLayoutConf ，也可以写成对象指定布局类型，见 layoutSecCfg
+	// 内置的布局可以直接使用，同名的配置会覆盖内置的布局:
+	//	default	: "[%T] %L %C (%S) %M"
+	//	logfmt	: time=... level=info category=... msg=... k=v
+	//	json	: 默认字段的 json 布局
+	// 过滤器没有指定布局时使用 default
+	Layouts    map[string]layoutSecCfg   `json:"layouts" yaml:"layouts"`
 	Categories map[string]categorySecCfg `json:"categories" yaml:"categories"`
 }
 
+// 根据配置创建的输出对象
+type outputInfo struct {
+	cfg    outputSecCfg
+	writer Writer
+}
 
 func loadFullCfg(cfg *fullConfig) error {
+	streamCfgs, name, err := consoleQueueCfgs(cfg.Files)
+	if err != nil {
+		return fmt.Errorf("output %s: %v", name, err)
+	}
+
+	gLoggerMu.Lock()
+	tree, outputs, err := buildFullCfg(cfg, gOutputs)
+	if err != nil {
+		gLoggerMu.Unlock()
+		return err
+	}
+
+	unused := setConsoleStreams(streamCfgs)
+	replaced, retired := applyFullCfg(tree, outputs)
+	unused = append(unused, replaced...)
+	gLoggerMu.Unlock()
+
+	// 不再使用的输出在锁外关闭，避免等待写入时阻塞 GetLogger
+	// 替换前已经获取了旧过滤器的日志调用可能还在写入，等它们完成后再关闭，保证日志不丢失
+	waitInflight(context.Background(), retired)
+	for _, w := range unused {
+		w.Close()
+	}
+	return nil
+}
+
+// 根据配置创建所有分类的过滤器以及输出对象，不修改全局状态
+// 配置没有变化的输出直接复用 old 中的对象，失败时关闭本次新创建的输出
+func buildFullCfg(cfg *fullConfig, old map[string]*outputInfo) (
+	tree *categoryTree, outputs map[string]*outputInfo, err error) {
+
 	layouts := map[string]*layoutInfo{}
-	writers := map[string]logWriter{}
+	tree = newCategoryTree()
+	outputs = map[string]*outputInfo{}
 
-	writers["console"] = gSingleConsoleWriter
+	defer func() {
+		if err != nil {
+			for _, w := range unusedOutputs(outputs, old) {
+				w.Close()
+			}
+		}
+	}()
 
-	// 创建分类，以及每个分类下的过滤器
-	for name, cateCfg := range cfg.Categories {
-		if !cateCfg.Enable || len(cateCfg.Filters) == 0 {
-			continue
+	consoleEnable := cfg.Global.ConsoleEnable == nil || *cfg.Global.ConsoleEnable
+
+	getLayout := func(name string) (*layoutInfo, error) {
+		name, layoutCfg, ok := lookupLayoutCfg(cfg.Layouts, name)
+		if !ok {
+			return nil, fmt.Errorf("layout %s not found in layouts config", name)
+		}
+		if layout, ok := layouts[name]; ok {
+			return layout, nil
 		}
 
-		c, ok := gLoggerMgr[name]
+		layout, err := newLayoutFromCfg(layoutCfg)
+		if err != nil {
+			return nil, fmt.Errorf("layout %s invalid: %v", name, err)
+		}
+		layout.Name = name
+		layouts[name] = layout
+		return layout, nil
+	}
+
+	// 关闭控制台时，控制台输出返回 nil ，不加入过滤器
+	getWriter := func(output string) (Writer, error) {
+		outputCfg, ok := cfg.Files[output]
 		if !ok {
-			c = &category{
-				category: name,
-				extSkip:  0,
-				filters:  make([]*categoryFilter, 0),
+			// 没有在 files 段中配置 console 或 stderr 时使用默认的控制台输出
+			if w := builtinOutput(output); w != nil {
+				if !consoleEnable {
+					return nil, nil
+				}
+				return w, nil
 			}
-			gLoggerMgr[name] = c
+			return nil, fmt.Errorf("output not found in files config")
+		}
+		if !consoleEnable && outputCfg.Type() == kConsoleWriterType {
+			return nil, nil
 		}
 
-		for _, filterCfg := range cateCfg.Filters {
-			layout, ok := layouts[filterCfg.Layout]
-			if !ok {
-				if layoutCfg, ok := cfg.Layouts[filterCfg.Layout]; !ok {
-					return fmt.Errorf("layout not found in layouts config")
-				} else {
-					layout = newLayoutConf(layoutCfg)
-					layouts[filterCfg.Layout] = layout
+		info, ok := outputs[output]
+		if !ok {
+			if info, ok = old[output]; !ok || !reflect.DeepEqual(info.cfg, outputCfg) {
+				writer, err := newWriter(output, outputCfg)
+				if err != nil {
+					return nil, fmt.Errorf("create output %s fail: %v", output, err)
 				}
+				info = &outputInfo{cfg: outputCfg, writer: writer}
 			}
+			outputs[output] = info
+		}
+		return info.writer, nil
+	}
 
-			filter := newFilter(c.category, strToLevel(filterCfg.Level), layout)
+	// 创建分类，以及每个分类下的过滤器
+	for name, cateCfg := range cfg.Categories {
+		if !cateCfg.Enable || len(cateCfg.Filters) == 0 {
+			continue
+		}
+		tree.additivity[name] = cateCfg.Additivity
+
+		for _, filterCfg := range cateCfg.Filters {
+			layout, err := getLayout(filterCfg.Layout)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			filter := newFilter(name, strToLevel(filterCfg.Level), layout)
+			filter.name = filterCfg.Name
 			for _, output := range filterCfg.Output {
-				writer, ok := writers[output]
-				if !ok {
-					if fileCfg, ok := cfg.Files[output]; !ok {
-						return fmt.Errorf("output not found in files config")
-					} else {
-						writer = newFileLogWriter(fileCfg)
-						writers[output] = writer
-					}
+				w, err := getWriter(output)
+				if err != nil {
+					return nil, nil, err
+				}
+				if w != nil {
+					filter.addWriter(output, w)
 				}
-
-				filter.writers = append(filter.writers, writer)
 			}
 
-			c.filters = append(c.filters, filter)
+			tree.filters[name] = append(tree.filters[name], filter)
 		}
 	}
 
-	return nil
+	// 没有配置的分类使用的过滤器
+	tree.defaults.level = strToLevel(cfg.Global.Level)
+	// 没有配置时为 default ，layouts 段中配置了 default 时使用配置的布局
+	if tree.defaults.layout, err = getLayout(cfg.Global.Layout); err != nil {
+		return nil, nil, err
+	}
+	defaultOutputs := cfg.Global.Output
+	if defaultOutputs == nil {
+		defaultOutputs = []string{kConsoleOutput}
+	}
+	tree.defaults.outputs, tree.defaults.writers = nil, nil
+	for _, output := range defaultOutputs {
+		w, err := getWriter(output)
+		if err != nil {
+			return nil, nil, err
+		}
+		if w != nil {
+			tree.defaults.outputs = append(tree.defaults.outputs, output)
+			tree.defaults.writers = append(tree.defaults.writers, w)
+		}
+	}
+
+	return tree, outputs, nil
+}
+
+// 替换所有分类的过滤器，返回不再使用的输出，以及被替换的过滤器的调用计数
+// 调用者需持有 gLoggerMu ，等待计数归零后再关闭返回的输出
+func applyFullCfg(tree *categoryTree, outputs map[string]*outputInfo) ([]Writer, []*inflight) {
+	retired := []*inflight{&currentCategoryTree().active}
+	gCategoryTree.Store(tree)
+	for name := range tree.filters {
+		getCategory(name)
+	}
+
+	for name, c := range gLoggerMgr {
+		if old := c.setFilters(tree.resolve(name)); old != nil {
+			retired = append(retired, &old.active)
+		}
+	}
+
+	layouts := tree.reportLayouts()
+	writers := []Writer{gConsoleOutput, gStderrOutput}
+	for _, info := range outputs {
+		writers = append(writers, info.writer)
+	}
+	for _, w := range writers {
+		for _, q := range queueWriters(w) {
+			q.setReportLayouts(layouts[q])
+		}
+	}
+
+	unused := unusedOutputs(gOutputs, outputs)
+	gOutputs = outputs
+	return unused, retired
+}
+
+// 返回 outputs 中没有被 keep 继续使用的输出对象
+func unusedOutputs(outputs, keep map[string]*outputInfo) []Writer {
+	var unused []Writer
+	for name, info := range outputs {
+		if k, ok := keep[name]; ok && k.writer == info.writer {
+			continue
+		}
+		unused = append(unused, info.writer)
+	}
+	return unused
 }
 
 //// -----------------------------------------------------------------------------------
@@ -152,38 +350,64 @@ func parseYaml(content []byte) (cfg *fullConfig, err error) {
 //// -----------------------------------------------------------------------------------
 
 func loadYamlFile(path string) error {
+	return loadConfigFile(path, kYamlConfigFormat)
+}
+
+func loadJsonFile(path string) error {
+	return loadConfigFile(path, kJsonConfigFormat)
+}
+
+func loadConfigFile(path string, format string) error {
 	content, err := readFile(path)
 	if err != nil {
 		return err
 	}
 
-	categories, err := parseYaml(content)
-	if err != nil {
+	if err := loadConfig(content, format); err != nil {
 		return err
 	}
-
-	return loadFullCfg(categories)
+	setConfigFile(path, format)
+	return nil
 }
 
-func loadJsonFile(path string) error {
-	content, err := readFile(path)
+// 解析并检查配置，有任何问题时返回所有问题，不修改当前配置
+func loadConfig(content []byte, format string) error {
+	cfg, err := parseConfig(content, format)
 	if err != nil {
 		return err
 	}
+	return loadFullCfg(cfg)
+}
 
-	cfg, err := parseJson(content)
-	if err != nil {
-		return err
-	}
+// 最近一次成功加载的配置文件，用于 Reload
+var gConfigFile atomic.Value
 
-	return loadFullCfg(cfg)
+type configFile struct {
+	path   string
+	format string // 加载时使用的格式，与扩展名无关
 }
 
-func loadJsonString(content string) error {
-	cfg, err := parseJson([]byte(content))
-	if err != nil {
-		return err
+func setConfigFile(path, format string) {
+	gConfigFile.Store(configFile{path: path, format: format})
+}
+
+// 重新加载最近一次成功加载的配置文件，使用加载时的格式
+func Reload() error {
+	file, _ := gConfigFile.Load().(configFile)
+	if file.path == "" {
+		return fmt.Errorf("no config file loaded")
 	}
+	return loadConfigFile(file.path, file.format)
+}
 
-	return loadFullCfg(cfg)
+// 根据扩展名选择配置格式，.json 为 json，其他都作为 yaml
+func loadFile(path string) error {
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		return loadJsonFile(path)
+	}
+	return loadYamlFile(path)
+}
+
+func loadJsonString(content string) error {
+	return loadConfig([]byte(content), kJsonConfigFormat)
 }
@@ -0,0 +1,184 @@
+package log4g
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// 测试用的输出，统计写入的行数，记录是否已经关闭以及关闭后的写入
+type countingWriter struct {
+	tag        interface{} // 配置中的 tag ，区分不同配置创建的输出
+	lines      int64
+	closed     int32
+	afterClose int64
+}
+
+func (w *countingWriter) Write(rec *FormattedRecord) {
+	if atomic.LoadInt32(&w.closed) != 0 {
+		atomic.AddInt64(&w.afterClose, 1)
+	}
+	atomic.AddInt64(&w.lines, 1)
+	rec.Release()
+}
+
+func (w *countingWriter) Close() {
+	atomic.StoreInt32(&w.closed, 1)
+}
+
+func (w *countingWriter) isClosed() bool {
+	return atomic.LoadInt32(&w.closed) != 0
+}
+
+var (
+	gCountingMu      sync.Mutex
+	gCountingWriters []*countingWriter // test_counting 类型创建的所有输出
+)
+
+func init() {
+	RegisterWriterType("test_counting", func(_ string, options map[string]interface{}) (Writer, error) {
+		w := &countingWriter{tag: options["tag"]}
+		gCountingMu.Lock()
+		gCountingWriters = append(gCountingWriters, w)
+		gCountingMu.Unlock()
+		return w, nil
+	})
+}
+
+func currentOutput(name string) Writer {
+	gLoggerMu.Lock()
+	defer gLoggerMu.Unlock()
+	if info, ok := gOutputs[name]; ok {
+		return info.writer
+	}
+	return nil
+}
+
+func TestReloadReusesWriters(t *testing.T) {
+	const config = `{
+		"files": {%s},
+		"categories": {"reload_test": {"enable": true, "filters": [{"output": [%s]}]}}
+	}`
+	load := func(files, outputs string) {
+		t.Helper()
+		if err := LoadJsonString(fmt.Sprintf(config, files, outputs)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer Close()
+
+	load(`"a": {"type": "test_counting", "tag": 1}, "b": {"type": "test_counting"}`, `"a", "b"`)
+	a, b := currentOutput("a").(*countingWriter), currentOutput("b").(*countingWriter)
+
+	// a 的配置不变继续使用，b 不再使用时关闭
+	load(`"a": {"type": "test_counting", "tag": 1}, "c": {"type": "test_counting"}`, `"a", "c"`)
+	if currentOutput("a") != a || a.isClosed() {
+		t.Fatal("unchanged output a was recreated")
+	}
+	if !b.isClosed() || currentOutput("b") != nil {
+		t.Fatal("unused output b was not closed")
+	}
+
+	logger := GetLogger("reload_test")
+	logger.Info("hello")
+	if atomic.LoadInt64(&a.lines) != 1 {
+		t.Fatal("reused output a did not receive the log")
+	}
+
+	// a 的配置变化时创建新的输出，关闭旧的输出
+	load(`"a": {"type": "test_counting", "tag": 2}`, `"a"`)
+	a2 := currentOutput("a").(*countingWriter)
+	if a2 == a || a2.tag != float64(2) || !a.isClosed() {
+		t.Fatal("changed output a was not replaced")
+	}
+	logger.Info("hello")
+	if atomic.LoadInt64(&a2.lines) != 1 || atomic.LoadInt64(&a.lines) != 1 {
+		t.Fatal("log was not written to the new output only")
+	}
+}
+
+// 重新加载时正在写入的日志写完后才关闭旧的输出，日志不丢失，关闭后也不再写入
+func TestReloadWhileLogging(t *testing.T) {
+	const config = `{
+		"files": {"out": {"type": "test_counting", "tag": %d}},
+		"categories": {"reload_test": {"enable": true, "filters": [{"output": ["out"]}]}}
+	}`
+	load := func(tag int) {
+		t.Helper()
+		if err := LoadJsonString(fmt.Sprintf(config, tag)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer Close()
+
+	load(0)
+	gCountingMu.Lock()
+	first := len(gCountingWriters) - 1
+	gCountingMu.Unlock()
+
+	const goroutines, n = 4, 2000
+	var wg sync.WaitGroup
+	logger := GetLogger("reload_test")
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				logger.Info("hello")
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+reload:
+	for tag := 1; ; tag++ {
+		select {
+		case <-done:
+			break reload
+		default:
+		}
+		load(tag)
+	}
+
+	gCountingMu.Lock()
+	writers := gCountingWriters[first:]
+	gCountingMu.Unlock()
+
+	var total int64
+	for _, w := range writers {
+		total += atomic.LoadInt64(&w.lines)
+		if after := atomic.LoadInt64(&w.afterClose); after > 0 {
+			t.Fatalf("%d lines written after close", after)
+		}
+	}
+	if total != goroutines*n {
+		t.Fatalf("got %d lines over %d reloads, want %d", total, len(writers)-1, goroutines*n)
+	}
+}
+
+// 配置中覆盖 default 布局后，没有配置布局的过滤器和没有配置的分类都使用它
+func TestOverrideDefaultLayout(t *testing.T) {
+	err := LoadJsonString(`{
+		"global": {"output": ["capture"]},
+		"files": {"capture": {"type": "test_capture"}},
+		"layouts": {"default": "%C|%M"},
+		"categories": {"layout_test": {"enable": true, "filters": [{"output": ["capture"]}]}}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	GetLogger("layout_test").Info("configured")
+	GetLogger("layout_other").Info("unconfigured")
+
+	want := []string{"layout_test|configured", "layout_other|unconfigured"}
+	if got := gCaptureWriter.getLines(); !equalStrings(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,325 @@
+package log4g
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-yaml/yaml"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// 配置内容的格式
+const (
+	kJsonConfigFormat = "json"
+	kYamlConfigFormat = "yaml"
+)
+
+/**
+ * 配置中的所有问题，每条为 "路径: 问题"，如
+ *	categories.TestA.filters[1].layout: "default" not defined
+ */
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid config:\n\t" + strings.Join(e.Problems, "\n\t")
+}
+
+// 输出等配置项的错误，key 为出错的配置项，检查配置时拼接到输出的路径后面
+type optionError struct {
+	key string
+	msg string
+}
+
+func optionErrorf(key, format string, args ...interface{}) error {
+	return &optionError{key: key, msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *optionError) Error() string {
+	return e.key + ": " + e.msg
+}
+
+// 检查配置内容，format 为 json 或 yaml ，返回语法错误，或者包含所有问题的 *ConfigError
+// 只检查，不修改当前的配置，也不创建输出
+func ValidateConfig(content []byte, format string) error {
+	_, err := parseConfig(content, format)
+	return err
+}
+
+// 解析并检查配置
+func parseConfig(content []byte, format string) (*fullConfig, error) {
+	var cfg *fullConfig
+	var raw interface{}
+	var err error
+
+	switch format {
+	case kJsonConfigFormat:
+		if cfg, err = parseJson(content); err == nil {
+			err = json.Unmarshal(content, &raw)
+		}
+	case kYamlConfigFormat:
+		if cfg, err = parseYaml(content); err == nil {
+			err = yaml.Unmarshal(content, &raw)
+		}
+	default:
+		return nil, fmt.Errorf("unknown config format %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v := &configValidator{cfg: cfg, fold: format == kJsonConfigFormat}
+	v.checkKeys("", raw, reflect.TypeOf(fullConfig{}))
+	v.checkValues(raw)
+	if len(v.problems) > 0 {
+		return nil, &ConfigError{Problems: v.problems}
+	}
+	return cfg, nil
+}
+
+/**
+ * 检查配置，收集所有问题
+ */
+type configValidator struct {
+	cfg      *fullConfig
+	fold     bool // json 解析时字段名不区分大小写
+	problems []string
+}
+
+func (v *configValidator) add(path string, format string, args ...interface{}) {
+	v.problems = append(v.problems, path+": "+fmt.Sprintf(format, args...))
+}
+
+// 添加错误，配置项的错误使用配置项的路径
+func (v *configValidator) addError(path string, err error) {
+	if oe, ok := err.(*optionError); ok {
+		v.add(path+"."+oe.key, "%s", oe.msg)
+		return
+	}
+	v.add(path, "%v", err)
+}
+
+func (v *configValidator) checkValues(raw interface{}) {
+	cfg := v.cfg
+
+	v.checkLevel("global.level", cfg.Global.Level)
+	v.checkLayoutRef("global.layout", cfg.Global.Layout)
+	for i, output := range cfg.Global.Output {
+		v.checkOutputRef(fmt.Sprintf("global.output[%d]", i), output)
+	}
+
+	rawFiles, _ := toStringMap(mapValue(raw, "files", v.fold))
+	for _, name := range sortedKeys(cfg.Files) {
+		v.checkOutput("files."+name, cfg.Files[name], rawFiles[name])
+	}
+
+	if _, name, err := consoleQueueCfgs(cfg.Files); err != nil {
+		v.add("files."+name, "%v", err)
+	}
+
+	for _, name := range sortedKeys(cfg.Layouts) {
+		if _, err := newLayoutFromCfg(cfg.Layouts[name]); err != nil {
+			v.add("layouts."+name, "%v", err)
+		}
+	}
+
+	for _, name := range sortedKeys(cfg.Categories) {
+		for i, filter := range cfg.Categories[name].Filters {
+			path := fmt.Sprintf("categories.%s.filters[%d]", name, i)
+			v.checkLevel(path+".level", filter.Level)
+			v.checkLayoutRef(path+".layout", filter.Layout)
+			for j, output := range filter.Output {
+				v.checkOutputRef(fmt.Sprintf("%s.output[%d]", path, j), output)
+			}
+		}
+	}
+}
+
+func (v *configValidator) checkLevel(path, level string) {
+	if _, ok := parseLevel(level); !ok && level != "" {
+		v.add(path, "unknown level %q", level)
+	}
+}
+
+func (v *configValidator) checkLayoutRef(path, name string) {
+	if _, _, ok := lookupLayoutCfg(v.cfg.Layouts, name); !ok {
+		v.add(path, "%q not defined", name)
+	}
+}
+
+func (v *configValidator) checkOutputRef(path, name string) {
+	if _, ok := v.cfg.Files[name]; ok {
+		return
+	}
+	if builtinOutput(name) == nil {
+		v.add(path, "%q not defined", name)
+	}
+}
+
+// 检查输出配置，内置的输出类型检查配置项和值，自定义的输出类型只检查类型是否注册
+func (v *configValidator) checkOutput(path string, cfg outputSecCfg, raw interface{}) {
+	switch cfg.Type() {
+	case kFileWriterType:
+		v.checkOptionKeys(path, raw, reflect.TypeOf(struct {
+			Type       string `yaml:"type"`
+			fileSecCfg `yaml:",inline"`
+		}{}))
+
+		var fileCfg fileSecCfg
+		if err := DecodeWriterOptions(cfg, &fileCfg); err != nil {
+			v.add(path, "%v", err)
+			return
+		}
+		for _, err := range fileCfg.validate() {
+			v.addError(path, err)
+		}
+	case kConsoleWriterType:
+		v.checkOptionKeys(path, raw, reflect.TypeOf(struct {
+			Type          string `yaml:"type"`
+			consoleSecCfg `yaml:",inline"`
+		}{}))
+
+		var consoleCfg consoleSecCfg
+		if err := DecodeWriterOptions(cfg, &consoleCfg); err != nil {
+			v.add(path, "%v", err)
+			return
+		}
+		for _, err := range consoleCfg.validate() {
+			v.addError(path, err)
+		}
+		// 创建控制台输出没有副作用
+		if _, err := newConsoleOutput(consoleCfg); err != nil {
+			v.addError(path, err)
+		}
+	default:
+		if _, ok := getWriterFactory(cfg.Type()); !ok {
+			v.add(path+".type", "unknown output type %q", cfg.Type())
+		}
+	}
+}
+
+// 输出的配置项由 DecodeWriterOptions 按 yaml 解析，json 配置也区分大小写
+func (v *configValidator) checkOptionKeys(path string, raw interface{}, t reflect.Type) {
+	fold := v.fold
+	v.fold = false
+	v.checkKeys(path, raw, t)
+	v.fold = fold
+}
+
+// 按结构体的字段检查配置中的键，报告没有对应字段的键
+func (v *configValidator) checkKeys(path string, raw interface{}, t reflect.Type) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		v.checkKeys(path, raw, t.Elem())
+	case reflect.Struct:
+		m, ok := toStringMap(raw)
+		if !ok {
+			return // 布局等可以写成字符串的配置
+		}
+		fields := structFields(t)
+		for _, key := range sortedKeys(m) {
+			ft, ok := v.lookupField(fields, key)
+			if !ok {
+				v.add(joinPath(path, key), "unknown key")
+				continue
+			}
+			v.checkKeys(joinPath(path, key), m[key], ft)
+		}
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.Interface {
+			return // 输出的配置项由输出类型决定，单独检查
+		}
+		m, _ := toStringMap(raw)
+		for _, key := range sortedKeys(m) {
+			v.checkKeys(joinPath(path, key), m[key], t.Elem())
+		}
+	case reflect.Slice:
+		items, _ := raw.([]interface{})
+		for i, item := range items {
+			v.checkKeys(fmt.Sprintf("%s[%d]", path, i), item, t.Elem())
+		}
+	}
+}
+
+func (v *configValidator) lookupField(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	if t, ok := fields[key]; ok {
+		return t, true
+	}
+	if v.fold {
+		for name, t := range fields {
+			if strings.EqualFold(name, key) {
+				return t, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// 结构体在配置中的字段名和类型，嵌入的结构体展开
+func structFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			for name, ft := range structFields(f.Type) {
+				fields[name] = ft
+			}
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// json 解析为 map[string]interface{} ，yaml 解析为 map[interface{}]interface{}
+func toStringMap(raw interface{}) (map[string]interface{}, bool) {
+	switch m := raw.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			out[fmt.Sprint(k)] = v
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func mapValue(raw interface{}, key string, fold bool) interface{} {
+	m, _ := toStringMap(raw)
+	for k, v := range m {
+		if k == key || (fold && strings.EqualFold(k, key)) {
+			return v
+		}
+	}
+	return nil
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// 按名称排序的键，使错误的顺序固定
+func sortedKeys(m interface{}) []string {
+	keys := reflect.ValueOf(m).MapKeys()
+	names := make([]string, 0, len(keys))
+	for _, k := range keys {
+		names = append(names, k.String())
+	}
+	sort.Strings(names)
+	return names
+}
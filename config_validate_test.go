@@ -0,0 +1,106 @@
+package log4g
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateConfigProblems(t *testing.T) {
+	err := ValidateConfig([]byte(`{
+		"global": {"level": "LOUD", "layout": "missing_layout", "output": ["nowhere"]},
+		"files": {
+			"f": {"type": "file", "maxsize": "abc", "compress": "zip", "bogus": 1},
+			"c": {"type": "console", "color": "rainbow"},
+			"x": {"type": "no_such_type"}
+		},
+		"layouts": {"bad": "%{unknown}"},
+		"categories": {"A": {"enable": true, "extra": true, "filters": [{"level": "LOUD", "layout": "nope", "output": ["missing"]}]}},
+		"unknown_top": 1
+	}`), kJsonConfigFormat)
+
+	cfgErr, ok := err.(*ConfigError)
+	if !ok {
+		t.Fatalf("got %v, want *ConfigError", err)
+	}
+
+	// 先是未知的键，再按 global 、 files 、 layouts 、 categories 的顺序，同一段内按名称排序
+	want := []string{
+		`categories.A.extra: unknown key`,
+		`unknown_top: unknown key`,
+		`global.level: unknown level "LOUD"`,
+		`global.layout: "missing_layout" not defined`,
+		`global.output[0]: "nowhere" not defined`,
+		`files.c.color: invalid color "rainbow", must be auto, always or never`,
+		`files.f.bogus: unknown key`,
+		`files.f.filename: is required`,
+		`files.f.maxsize: invalid size "abc"`,
+		`files.f.compress: unsupported compress "zip"`,
+		`files.x.type: unknown output type "no_such_type"`,
+		`layouts.bad: unknown section 'unknown'`,
+		`categories.A.filters[0].level: unknown level "LOUD"`,
+		`categories.A.filters[0].layout: "nope" not defined`,
+		`categories.A.filters[0].output[0]: "missing" not defined`,
+	}
+	if !equalStrings(cfgErr.Problems, want) {
+		t.Fatalf("got problems\n\t%q\nwant\n\t%q", cfgErr.Problems, want)
+	}
+}
+
+func TestValidateConfigYaml(t *testing.T) {
+	err := ValidateConfig([]byte("categories:\n  A:\n    enable: true\n    Filters: []\n"), kYamlConfigFormat)
+	cfgErr, ok := err.(*ConfigError)
+	if !ok || !equalStrings(cfgErr.Problems, []string{"categories.A.Filters: unknown key"}) {
+		t.Fatalf("got %v, want case sensitive keys in yaml", err)
+	}
+}
+
+func init() {
+	RegisterWriterType("test_failing", func(_ string, _ map[string]interface{}) (Writer, error) {
+		return nil, errors.New("cannot create")
+	})
+}
+
+// 加载失败时保留原有的输出、分类树和已注册分类的过滤器
+func TestFailedLoadKeepsConfig(t *testing.T) {
+	if err := LoadJsonString(kLevelTestConfig); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	logger := GetLogger("level_test").(*category)
+	tree, set, streams := currentCategoryTree(), logger.getFilterSet(), loadConsoleStreams()
+	gLoggerMu.Lock()
+	outputs := map[string]*outputInfo{}
+	for name, info := range gOutputs {
+		outputs[name] = info
+	}
+	gLoggerMu.Unlock()
+
+	configs := []string{
+		// 检查不通过
+		`{"categories": {"level_test": {"enable": true, "filters": [{"level": "LOUD"}]}}}`,
+		// 检查通过，创建输出失败
+		`{
+			"files": {"con": {"type": "console", "queue_size": 4}, "bad": {"type": "test_failing"}},
+			"categories": {"level_test": {"enable": true, "filters": [{"output": ["con", "bad"]}]}}
+		}`,
+	}
+	for _, config := range configs {
+		if err := LoadJsonString(config); err == nil {
+			t.Fatalf("loading %s succeeded", config)
+		}
+
+		if currentCategoryTree() != tree || logger.getFilterSet() != set || loadConsoleStreams() != streams {
+			t.Fatal("failed load replaced the category tree")
+		}
+		gLoggerMu.Lock()
+		same := len(gOutputs) == len(outputs)
+		for name, info := range gOutputs {
+			same = same && outputs[name] == info
+		}
+		gLoggerMu.Unlock()
+		if !same {
+			t.Fatal("failed load changed the outputs")
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package log4g
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// 检查配置文件是否变化的时间间隔
+const kWatchInterval = time.Second
+
+var (
+	gWatcherMu sync.Mutex
+	gWatcher   *configWatcher // 当前正在监视的配置文件，同一时间只监视一个
+)
+
+/**
+ * 配置文件监视器，定时检查文件的修改时间和大小，变化后重新加载配置
+ */
+type configWatcher struct {
+	path    string
+	modTime time.Time
+	size    int64
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// 加载配置文件，并在文件变化时自动重新加载，格式由扩展名决定
+func WatchConfig(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if err := loadFile(path); err != nil {
+		return err
+	}
+
+	w := &configWatcher{
+		path:    path,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		done:    make(chan struct{}),
+	}
+
+	gWatcherMu.Lock()
+	defer gWatcherMu.Unlock()
+
+	if gWatcher != nil {
+		gWatcher.stop()
+	}
+	gWatcher = w
+
+	w.wg.Add(1)
+	go w.run()
+
+	return nil
+}
+
+func stopWatch() {
+	gWatcherMu.Lock()
+	defer gWatcherMu.Unlock()
+
+	if gWatcher != nil {
+		gWatcher.stop()
+		gWatcher = nil
+	}
+}
+
+func (w *configWatcher) stop() {
+	close(w.done)
+	w.wg.Wait()
+}
+
+func (w *configWatcher) run() {
+	defer w.wg.Done()
+	defer doRecover()
+
+	ticker := time.NewTicker(kWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// 文件变化后重新加载，加载失败时保留原有配置
+func (w *configWatcher) check() {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return
+	}
+
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return
+	}
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+
+	if err := loadFile(w.path); err != nil {
+		fmt.Println("reload config", w.path, "fail:", err)
+	}
+}
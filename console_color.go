@@ -0,0 +1,118 @@
+package log4g
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const kColorReset = "\x1b[0m"
+
+// 可以在配置中使用的颜色名称，对应 SGR 参数
+var kColorNames = map[string]string{
+	"black":   "30",
+	"red":     "31",
+	"green":   "32",
+	"yellow":  "33",
+	"blue":    "34",
+	"magenta": "35",
+	"cyan":    "36",
+	"white":   "37",
+	"gray":    "90",
+	"bold":    "1",
+}
+
+// 每个等级的颜色，为完整的转义序列，为空时不着色
+type palette [CRITICAL + 1]string
+
+var kDefaultPalette = palette{
+	DEBUG:    "\x1b[36m",
+	TRACE:    "\x1b[90m",
+	INFO:     "\x1b[32m",
+	WARNING:  "\x1b[33m",
+	ERROR:    "\x1b[31m",
+	CRITICAL: "\x1b[1;31m",
+}
+
+// 在默认颜色的基础上设置配置的颜色，key 为等级名称，value 为颜色名称或 SGR 参数(如 '1;31')，为空时该等级不着色
+func newPalette(cfg map[string]string) (palette, error) {
+	p := kDefaultPalette
+	for name, color := range cfg {
+		level, ok := parseLevel(name)
+		if !ok {
+			return p, optionErrorf("palette."+name, "unknown level %q", name)
+		}
+
+		code, err := parseColor(color)
+		if err != nil {
+			return p, optionErrorf("palette."+name, "%v", err)
+		}
+		p[level] = code
+	}
+	return p, nil
+}
+
+func parseColor(color string) (string, error) {
+	if color == "" {
+		return "", nil
+	}
+	if code, ok := kColorNames[strings.ToLower(color)]; ok {
+		return "\x1b[" + code + "m", nil
+	}
+
+	for _, ch := range color {
+		if (ch < '0' || ch > '9') && ch != ';' {
+			return "", fmt.Errorf("invalid color %q", color)
+		}
+	}
+	return "\x1b[" + color + "m", nil
+}
+
+// 按等级着色，布局中有 %{color} 时只着色 %{color} 到 %{reset} 之间的部分，否则着色整行
+// 结果追加到 buf 中，以换行符结尾
+func (p *palette) colorize(buf []byte, rec *FormattedRecord) []byte {
+	line := rec.Formatted
+
+	code := ""
+	if rec.Level >= 0 && int(rec.Level) < len(p) {
+		code = p[rec.Level]
+	}
+	if code == "" {
+		buf = append(buf, line...)
+		return append(buf, '\n')
+	}
+
+	pos := 0
+	spans := rec.spans
+	if len(spans) == 0 {
+		whole := [2]int{0, len(line)}
+		spans = whole[:]
+	}
+	for i := 0; i < len(spans); i += 2 {
+		start, end := spans[i], len(line)
+		if i+1 < len(spans) {
+			end = spans[i+1]
+		}
+
+		buf = append(buf, line[pos:start]...)
+		buf = append(buf, code...)
+		buf = append(buf, line[start:end]...)
+		buf = append(buf, kColorReset...)
+		pos = end
+	}
+	buf = append(buf, line[pos:]...)
+	return append(buf, '\n')
+}
+
+// auto 模式下是否着色，设置了 NO_COLOR 环境变量或者不是终端时不着色
+func isColorTerminal(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
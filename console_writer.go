@@ -1,51 +1,294 @@
 package log4g
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"sync"
+	"reflect"
+	"sync/atomic"
 )
 
-// 不会被关闭的
-var gSingleConsoleWriter = newConsoleLogWriter()
+// 配置中使用控制台输出的名称，分别输出到标准输出和标准错误
+const (
+	kConsoleOutput = "console"
+	kStderrOutput  = "stderr"
+)
+
+// 控制台输出类型，files 段中 type 为 console 时可以配置颜色等选项
+const kConsoleWriterType = "console"
+
+// 控制台的流
+const (
+	kStdoutStream = iota
+	kStderrStream
+	kStreamCount
+)
+
+var (
+	kStreamNames = [kStreamCount]string{"stdout", "stderr"}
+	kStreamFiles = [kStreamCount]*os.File{os.Stdout, os.Stderr}
+)
+
+// 控制台写入队列的默认长度
+const kConsoleQueueSize = 16
+
+/**
+ * 控制台的写入队列，每个流只有一个，所有输出到同一个流的日志按顺序整行写入，不会交错
+ * 队列不会被关闭，配置中的队列配置变化时替换为新的队列，旧队列写完剩余的日志后关闭
+ * 替换前后短时间内两个队列同时写入，每行仍然完整，但顺序可能交错
+ */
+type consoleStreams struct {
+	writers [kStreamCount]*asyncWriter
+	cfgs    [kStreamCount]queueSecCfg // 创建队列的配置
+}
+
+var gConsoleStreams atomic.Value // *consoleStreams ，替换时持有 gLoggerMu
+
+func init() {
+	streams := &consoleStreams{}
+	for i := range streams.writers {
+		streams.writers[i], _ = newAsyncWriter(&consoleLogWriter{out: kStreamFiles[i]}, queueSecCfg{}, kConsoleQueueSize)
+	}
+	gConsoleStreams.Store(streams)
+}
+
+func loadConsoleStreams() *consoleStreams {
+	return gConsoleStreams.Load().(*consoleStreams)
+}
+
+// 按配置替换控制台的写入队列，返回被替换的队列，调用者需持有 gLoggerMu
+// 只有 async 变化时不替换，与 SetAsync 相同直接切换，被替换的队列由调用者在正在写入的日志完成后关闭
+func setConsoleStreams(cfgs [kStreamCount]queueSecCfg) []Writer {
+	cur := loadConsoleStreams()
+	next := *cur
 
-func newConsoleLogWriter() *consoleLogWriter {
-	writer := &consoleLogWriter{
-		ch: make(chan *formattedRecord, 16),
-		wg: sync.WaitGroup{},
+	changed := false
+	var replaced []Writer
+	for i, cfg := range cfgs {
+		if reflect.DeepEqual(cfg, cur.cfgs[i]) {
+			continue
+		}
+		changed = true
+
+		queue, curQueue := cfg, cur.cfgs[i]
+		queue.Async, curQueue.Async = nil, nil
+		if reflect.DeepEqual(queue, curQueue) {
+			cur.writers[i].setAsync(cfg.Async == nil || *cfg.Async)
+			next.cfgs[i] = cfg
+			continue
+		}
+
+		w, err := newAsyncWriter(&consoleLogWriter{out: kStreamFiles[i]}, cfg, kConsoleQueueSize)
+		if err != nil {
+			fmt.Println("console", kStreamNames[i], err)
+			continue
+		}
+		next.writers[i], next.cfgs[i] = w, cfg
+		replaced = append(replaced, cur.writers[i])
+	}
+
+	if changed {
+		gConsoleStreams.Store(&next)
+	}
+	return replaced
+}
+
+// 根据 files 段中的控制台输出计算每个流的队列配置，输出的队列配置作用于它使用的所有流
+// 同一个流上的多个输出配置了不同的队列配置时返回错误，name 为出错的输出，配置有误的输出忽略
+func consoleQueueCfgs(files map[string]outputSecCfg) (cfgs [kStreamCount]queueSecCfg, name string, err error) {
+	var owners [kStreamCount]string
+	for _, name := range sortedKeys(files) {
+		if files[name].Type() != kConsoleWriterType {
+			continue
+		}
+
+		var cfg consoleSecCfg
+		if err := DecodeWriterOptions(files[name], &cfg); err != nil {
+			continue
+		}
+		if reflect.DeepEqual(cfg.queueSecCfg, queueSecCfg{}) {
+			continue
+		}
+		w, err := newConsoleOutput(cfg)
+		if err != nil {
+			continue
+		}
+
+		for _, idx := range w.streamIndexes() {
+			if owners[idx] != "" && !reflect.DeepEqual(cfgs[idx], cfg.queueSecCfg) {
+				return cfgs, name, fmt.Errorf("queue config of %s conflicts with files.%s", kStreamNames[idx], owners[idx])
+			}
+			owners[idx], cfgs[idx] = name, cfg.queueSecCfg
+		}
+	}
+	return cfgs, "", nil
+}
+
+// 内置的控制台输出，不着色，没有在 files 段中配置同名的输出时使用
+var (
+	gConsoleOutput = &consoleOutput{stream: kStdoutStream, errStream: kStdoutStream, stderrLevel: CRITICAL + 1}
+	gStderrOutput  = &consoleOutput{stream: kStderrStream, errStream: kStderrStream, stderrLevel: CRITICAL + 1}
+)
+
+// 内置的控制台输出，不是 console 或 stderr 时返回 nil
+func builtinOutput(name string) *consoleOutput {
+	switch name {
+	case kConsoleOutput:
+		return gConsoleOutput
+	case kStderrOutput:
+		return gStderrOutput
 	}
-	go writer.Run()
-	return writer
+	return nil
 }
 
 type consoleLogWriter struct {
-	ch chan *formattedRecord
-	wg sync.WaitGroup
-	open bool
+	out *os.File
+}
+
+func (w *consoleLogWriter) process(rec *FormattedRecord) bool {
+	_, err := w.out.Write(rec.line())
+	return err == nil
 }
 
-func (w *consoleLogWriter) Write(msg *formattedRecord) {
-	w.ch <- msg
+// 标准输出可能是终端或管道，不支持同步，忽略错误
+func (w *consoleLogWriter) sync() error {
+	_ = w.out.Sync()
+	return nil
 }
 
-func (w *consoleLogWriter) Close() {
-	if !w.open {
+func (w *consoleLogWriter) close() {
+}
+
+// 控制台输出段配置
+//
+//	console:
+//	  type: console
+//	  color: auto
+//	  palette: { INFO: green, ERROR: '1;31' }
+//	  stderr_level: ERROR
+//	  queue_size: 64
+type consoleSecCfg struct {
+	Color       string            `json:"color" yaml:"color"`               // auto|always|never, default is never
+	Palette     map[string]string `json:"palette" yaml:"palette"`           // 等级对应的颜色，颜色名称或 SGR 参数，未配置的等级使用默认颜色
+	Stream      string            `json:"stream" yaml:"stream"`             // stdout|stderr, default is stdout
+	StderrLevel string            `json:"stderr_level" yaml:"stderr_level"` // 不低于此等级的日志输出到标准错误，默认为空不分流
+
+	// 输出使用的流的队列配置，默认长度为 16 ，同一个流上的所有控制台输出共用队列，只能有一种队列配置
+	// async 为 false 时流同步写入，与 SetAsync 相同
+	queueSecCfg `yaml:",inline"`
+}
+
+func consoleWriterFactory(_ string, options map[string]interface{}) (Writer, error) {
+	var cfg consoleSecCfg
+	if err := DecodeWriterOptions(options, &cfg); err != nil {
+		return nil, err
+	}
+	if errs := cfg.validate(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return newConsoleOutput(cfg)
+}
+
+func newConsoleOutput(cfg consoleSecCfg) (*consoleOutput, error) {
+	w := &consoleOutput{
+		stream:      kStdoutStream,
+		errStream:   kStderrStream,
+		stderrLevel: CRITICAL + 1,
+	}
+
+	switch cfg.Stream {
+	case "", "stdout":
+	case "stderr":
+		w.stream = kStderrStream
+	default:
+		return nil, optionErrorf("stream", "invalid stream %q, must be stdout or stderr", cfg.Stream)
+	}
+
+	if cfg.StderrLevel != "" {
+		level, ok := parseLevel(cfg.StderrLevel)
+		if !ok {
+			return nil, optionErrorf("stderr_level", "unknown level %q", cfg.StderrLevel)
+		}
+		w.stderrLevel = level
+	}
+
+	switch cfg.Color {
+	case "", "never":
+	case "always":
+		w.color, w.errColor = true, true
+	case "auto":
+		w.color = isColorTerminal(kStreamFiles[w.stream])
+		w.errColor = isColorTerminal(os.Stderr)
+	default:
+		return nil, optionErrorf("color", "invalid color %q, must be auto, always or never", cfg.Color)
+	}
+
+	palette, err := newPalette(cfg.Palette)
+	if err != nil {
+		return nil, err
+	}
+	w.palette = palette
+
+	return w, nil
+}
+
+/**
+ * 配置的控制台输出，按配置着色后交给对应流的写入队列，输出到同一个流的控制台输出共用同一个队列，保证输出顺序
+ * 写入时才获取流当前的队列，队列被替换后无需重新创建，写入队列不会被关闭，Close 不做任何操作
+ */
+type consoleOutput struct {
+	stream      int // 标准输出或标准错误
+	errStream   int // 不低于 stderrLevel 的日志写入标准错误
+	stderrLevel Level
+	color       bool // stream 是否着色
+	errColor    bool // errStream 是否着色
+	palette     palette
+}
+
+func (w *consoleOutput) Write(rec *FormattedRecord) {
+	idx, color := w.stream, w.color
+	if rec.Level >= w.stderrLevel {
+		idx, color = w.errStream, w.errColor
+	}
+	stream := loadConsoleStreams().writers[idx]
+
+	if !color {
+		stream.Write(rec)
 		return
 	}
-	close(w.ch)
-	w.wg.Wait()
+
+	colored := getFormattedRecord(rec.Created, rec.Level, rec.Category, 1)
+	colored.setLine(w.palette.colorize(colored.buf, rec))
+	rec.Release()
+	stream.Write(colored)
 }
 
-func (w *consoleLogWriter) Run() {
-	defer doRecover()
+// 使用到的流
+func (w *consoleOutput) streamIndexes() []int {
+	if w.stderrLevel > CRITICAL || w.stream == w.errStream {
+		return []int{w.stream}
+	}
+	return []int{w.stream, w.errStream}
+}
 
-	w.wg.Add(1)
-	w.open = true
+// 使用到的流当前的写入队列
+func (w *consoleOutput) streams() []*asyncWriter {
+	streams := loadConsoleStreams()
+	var writers []*asyncWriter
+	for _, idx := range w.streamIndexes() {
+		writers = append(writers, streams.writers[idx])
+	}
+	return writers
+}
 
-	for rec := range w.ch {
-		fmt.Fprintln(os.Stdout, rec.Formatted)
+func (w *consoleOutput) Flush(ctx context.Context) error {
+	for _, s := range w.streams() {
+		if err := s.Flush(ctx); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	w.open = false
-	w.wg.Done()
+func (w *consoleOutput) Close() {
 }
@@ -0,0 +1,48 @@
+package log4g
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func isStreamAsync(idx int) bool {
+	return atomic.LoadInt32(&loadConsoleStreams().writers[idx].inline) == 0
+}
+
+func TestConsoleAsyncOption(t *testing.T) {
+	const config = `{
+		"files": {"con": {"type": "console", "stderr_level": "ERROR", "async": %s}},
+		"categories": {"console_test": {"enable": true, "filters": [{"output": ["con"]}]}}
+	}`
+	defer Close()
+
+	if err := LoadJsonString(fmt.Sprintf(config, "false")); err != nil {
+		t.Fatal(err)
+	}
+	if isStreamAsync(kStdoutStream) || isStreamAsync(kStderrStream) {
+		t.Fatal("async: false did not make both streams of the output synchronous")
+	}
+
+	if err := LoadJsonString(fmt.Sprintf(config, "true")); err != nil {
+		t.Fatal(err)
+	}
+	if !isStreamAsync(kStdoutStream) || !isStreamAsync(kStderrStream) {
+		t.Fatal("async: true did not switch the streams back")
+	}
+}
+
+func TestConsoleQueueConflict(t *testing.T) {
+	err := ValidateConfig([]byte(`{"files": {
+		"a": {"type": "console", "queue_size": 64},
+		"b": {"type": "console", "queue_size": 8}
+	}}`), kJsonConfigFormat)
+
+	cfgErr, ok := err.(*ConfigError)
+	if !ok || len(cfgErr.Problems) != 1 {
+		t.Fatalf("got %v, want one conflict", err)
+	}
+	if want := "files.b: queue config of stdout conflicts with files.a"; cfgErr.Problems[0] != want {
+		t.Fatalf("got %q, want %q", cfgErr.Problems[0], want)
+	}
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"time"
+	"sync"
 
 	log "log4g"
 )
@@ -19,7 +19,10 @@ func testLog()  {
 	t.Error("test error")
 	t.Critical("test critical")
 
+	wg := sync.WaitGroup{}
+	wg.Add(2)
 	go func() {
+		defer wg.Done()
 		tb := log.GetLogger("TestB")
 		tb.Debug("test debug")
 		tb.Info("test info")
@@ -28,6 +31,7 @@ func testLog()  {
 	}()
 
 	go func() {
+		defer wg.Done()
 		tb := log.GetLogger("TestB")
 		tb.Debug("test debug")
 		tb.Info("test info")
@@ -36,7 +40,6 @@ func testLog()  {
 	}()
 
 	log.Info("console info")
-	time.Sleep(time.Second * 1)
-	log.Close()
-	time.Sleep(time.Second * 1)
+	wg.Wait()
+	log.Close() // 等待所有已经写入的日志输出完成
 }
\ No newline at end of file
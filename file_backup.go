@@ -0,0 +1,163 @@
+package log4g
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	kGzipCompress = "gzip"
+	kGzipSuffix   = ".gz"
+)
+
+// 通知后台协程处理轮转后的文件，已经有待处理的通知时直接返回，不会阻塞写日志
+func (w *fileLogWriter) notifyBackground() {
+	if w.bgCh == nil {
+		return
+	}
+
+	select {
+	case w.bgCh <- struct{}{}:
+	default:
+	}
+}
+
+func (w *fileLogWriter) runBackground() {
+	defer w.bgWg.Done()
+	defer doRecover()
+
+	for range w.bgCh {
+		if w.compress {
+			w.compressBackups()
+		}
+		if w.maxBackups > 0 || w.maxAge > 0 {
+			w.removeBackups(time.Now())
+		}
+	}
+}
+
+type backupFile struct {
+	path    string
+	modTime time.Time
+}
+
+// 查找轮转产生的文件，按修改时间从新到旧排序
+// filename_20060102.log, filename_20060102_n.log, filename_n.log 以及压缩后的 .log.gz
+func (w *fileLogWriter) listBackups() ([]backupFile, error) {
+	dir := filepath.Dir(w.filename)
+	basename := filepath.Base(w.filename)
+	basename = basename[:len(basename)-4]
+
+	pattern := regexp.MustCompile("^" + regexp.QuoteMeta(basename) + `_(\d{8}(_\d+)?|\d+)\.log(\.gz)?$`)
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backupFile
+	for _, info := range infos {
+		if info.IsDir() || !pattern.MatchString(info.Name()) {
+			continue
+		}
+		backups = append(backups, backupFile{
+			path:    filepath.Join(dir, info.Name()),
+			modTime: info.ModTime(),
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].modTime.After(backups[j].modTime)
+	})
+	return backups, nil
+}
+
+// 删除超过保留数量或保留时间的轮转文件
+func (w *fileLogWriter) removeBackups(now time.Time) {
+	backups, err := w.listBackups()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for i, b := range backups {
+		if (w.maxBackups > 0 && i >= w.maxBackups) ||
+			(w.maxAge > 0 && now.Sub(b.modTime) > w.maxAge) {
+			if err := os.Remove(b.path); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+}
+
+// 压缩所有还没有压缩的轮转文件
+func (w *fileLogWriter) compressBackups() {
+	backups, err := w.listBackups()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for _, b := range backups {
+		if strings.HasSuffix(b.path, kGzipSuffix) {
+			continue
+		}
+		if err := gzipFile(b.path, b.modTime); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// 将文件压缩为 path.gz ，先写入临时文件并同步到磁盘，再重命名并删除原文件
+// 压缩文件的修改时间设置为原文件的修改时间，保证按时间清理的顺序不变
+func gzipFile(path string, modTime time.Time) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + kGzipSuffix + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			dst.Close()
+			os.Remove(tmp)
+		}
+	}()
+
+	gw := gzip.NewWriter(dst)
+	if _, err = io.Copy(gw, src); err != nil {
+		return err
+	}
+	if err = gw.Close(); err != nil {
+		return err
+	}
+	if err = dst.Sync(); err != nil {
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Chtimes(tmp, modTime, modTime); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, path+kGzipSuffix); err != nil {
+		return err
+	}
+
+	src.Close()
+	return os.Remove(path)
+}
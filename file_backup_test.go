@@ -0,0 +1,188 @@
+package log4g
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func makeTempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "log4g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// 创建文件并设置修改时间
+func writeFileAt(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRemoveBackupsKeepsNewest(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	// 文件名的顺序和修改时间的顺序不同，按修改时间保留
+	files := []struct {
+		name string
+		age  time.Duration
+	}{
+		{"app_1.log", 5 * time.Hour},
+		{"app_2.log", 1 * time.Hour},
+		{"app_3.log", 4 * time.Hour},
+		{"app_20260101.log.gz", 2 * time.Hour},
+		{"app_20260102_1.log", 3 * time.Hour},
+		{"app.log", 10 * time.Hour},     // 当前文件
+		{"other_1.log", 10 * time.Hour}, // 其他文件的轮转文件
+		{"app_x.log", 10 * time.Hour},   // 不是轮转产生的文件名
+	}
+	for _, f := range files {
+		writeFileAt(t, filepath.Join(dir, f.name), f.name, now.Add(-f.age))
+	}
+
+	w := &fileLogWriter{filename: filepath.Join(dir, "app.log"), maxBackups: 3}
+	w.removeBackups(now)
+
+	want := []string{"app.log", "app_2.log", "app_20260101.log.gz", "app_20260102_1.log", "app_x.log", "other_1.log"}
+	if got := listDir(t, dir); !equalStrings(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestRemoveBackupsMaxAge(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	writeFileAt(t, filepath.Join(dir, "app_1.log"), "old", now.Add(-48*time.Hour))
+	writeFileAt(t, filepath.Join(dir, "app_2.log.gz"), "old", now.Add(-25*time.Hour))
+	writeFileAt(t, filepath.Join(dir, "app_3.log"), "new", now.Add(-time.Hour))
+
+	w := &fileLogWriter{filename: filepath.Join(dir, "app.log"), maxAge: 24 * time.Hour}
+	w.removeBackups(now)
+
+	if got, want := listDir(t, dir), []string{"app_3.log"}; !equalStrings(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestRenameFileAvoidsCompressed(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	filename := filepath.Join(dir, "app.log")
+	writeFileAt(t, filename, "current", now)
+	writeFileAt(t, filepath.Join(dir, "app_1.log.gz"), "compressed", now)
+	writeFileAt(t, filepath.Join(dir, "app_2.log"), "rotated", now)
+
+	w := &fileLogWriter{filename: filename}
+	if !w.renameFile(filename, filename, 1) {
+		t.Fatal("renameFile failed")
+	}
+
+	want := []string{"app_1.log.gz", "app_2.log", "app_3.log"}
+	if got := listDir(t, dir); !equalStrings(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "app_3.log")); string(data) != "current" {
+		t.Fatalf("app_3.log contains %q", data)
+	}
+}
+
+func TestGzipFile(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app_1.log")
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	writeFileAt(t, path, "line1\nline2\n", modTime)
+
+	if err := gzipFile(path, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := listDir(t, dir), []string{"app_1.log.gz"}; !equalStrings(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	f, err := os.Open(path + kGzipSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadAll(gr); err != nil || string(data) != "line1\nline2\n" {
+		t.Fatalf("decompressed %q, %v", data, err)
+	}
+
+	info, _ := f.Stat()
+	if !info.ModTime().Equal(modTime) {
+		t.Fatalf("modification time %v, want %v", info.ModTime(), modTime)
+	}
+}
+
+// 重命名失败时原文件保留，临时文件删除
+func TestGzipFileKeepsOriginalOnFailure(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app_1.log")
+	writeFileAt(t, path, "keep me", time.Now())
+
+	// 目标位置是非空目录，重命名会失败
+	if err := os.MkdirAll(filepath.Join(path+kGzipSuffix, "sub"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gzipFile(path, time.Now()); err == nil {
+		t.Fatal("gzipFile succeeded, want rename error")
+	}
+	if got, want := listDir(t, dir), []string{"app_1.log", "app_1.log.gz"}; !equalStrings(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "keep me" {
+		t.Fatalf("original contains %q", data)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
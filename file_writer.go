@@ -1,6 +1,7 @@
 package log4g
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"strings"
@@ -8,7 +9,44 @@ import (
 	"time"
 )
 
-func newFileLogWriter(cfg fileSecCfg) *fileLogWriter {
+const kFileWriterType = "file"
+
+func fileWriterFactory(_ string, options map[string]interface{}) (Writer, error) {
+	var cfg fileSecCfg
+	if err := DecodeWriterOptions(options, &cfg); err != nil {
+		return nil, err
+	}
+	if errs := cfg.validate(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return newFileLogWriter(cfg)
+}
+
+// 检查文件输出配置，返回所有错误
+func (c *fileSecCfg) validate() []error {
+	var errs []error
+	if c.Filename == "" {
+		errs = append(errs, optionErrorf("filename", "is required"))
+	}
+	if _, err := parseNumSuffix(c.Maxsize, 1024); err != nil {
+		errs = append(errs, optionErrorf("maxsize", "invalid size %q", c.Maxsize))
+	}
+	if _, err := parseNumSuffix(c.Maxline, 1000); err != nil {
+		errs = append(errs, optionErrorf("maxline", "invalid line count %q", c.Maxline))
+	}
+	if c.MaxBackups < 0 {
+		errs = append(errs, optionErrorf("max_backups", "must not be negative"))
+	}
+	if _, err := parseDuration(c.MaxAge); err != nil {
+		errs = append(errs, optionErrorf("max_age", "invalid duration %q", c.MaxAge))
+	}
+	if c.Compress != "" && c.Compress != kGzipCompress {
+		errs = append(errs, optionErrorf("compress", "unsupported compress %q", c.Compress))
+	}
+	return append(errs, c.queueSecCfg.validate()...)
+}
+
+func newFileLogWriter(cfg fileSecCfg) (*asyncWriter, error) {
 	w := &fileLogWriter{
 		filename: cfg.Filename,
 		rotate:   cfg.Rotate,
@@ -16,9 +54,9 @@ func newFileLogWriter(cfg fileSecCfg) *fileLogWriter {
 		maxline:  strToNumSuffix(cfg.Maxline, 1000),
 		daily:    cfg.Daily,
 
-		ch:     make(chan *formattedRecord, 32),
-		wg:     sync.WaitGroup{},
-		opened: false,
+		maxBackups: cfg.MaxBackups,
+		maxAge:     strToDuration(cfg.MaxAge),
+		compress:   cfg.Compress == kGzipCompress,
 
 		file:     nil,
 		currDay:  0,
@@ -29,37 +67,39 @@ func newFileLogWriter(cfg fileSecCfg) *fileLogWriter {
 		w.filename += ".log"
 	}
 
-	go w.Run()
+	if w.maxBackups > 0 || w.maxAge > 0 || w.compress {
+		w.bgCh = make(chan struct{}, 1)
+		w.bgWg.Add(1)
+		go w.runBackground()
+		w.notifyBackground()
+	}
 
-	return w
+	aw, err := newAsyncWriter(w, cfg.queueSecCfg, 32)
+	if err != nil {
+		w.close()
+		return nil, err
+	}
+	return aw, nil
 }
 
 type fileLogWriter struct {
 	filename string
 	rotate   bool
 	maxsize  int64
-	maxline  int64 // unused
+	maxline  int64
 	daily    bool
 
-	ch     chan *formattedRecord
-	wg     sync.WaitGroup
-	opened bool
+	maxBackups int           // 保留的轮转文件数量
+	maxAge     time.Duration // 轮转文件保留的时间
+	compress   bool          // 轮转文件是否使用 gzip 压缩
 
-	file     *os.File // 文件句柄
-	currDay  int      // 文件创建时间，在一年中的某天(认为日志不会存在一年都没有写一条记录)
-	currSize int64    // 当前文件大小
-}
+	bgCh chan struct{} // 通知后台协程处理轮转后的文件，为空时不需要处理
+	bgWg sync.WaitGroup
 
-func (w *fileLogWriter) Write(msg *formattedRecord) {
-	w.ch <- msg
-}
-
-func (w *fileLogWriter) Close() {
-	if !w.opened {
-		return
-	}
-	close(w.ch)
-	w.wg.Wait()
+	file      *os.File // 文件句柄
+	currDay   int      // 文件创建时间，在一年中的某天(认为日志不会存在一年都没有写一条记录)
+	currSize  int64    // 当前文件大小
+	currLines int64    // 当前文件行数，包括打开时文件中已有的行
 }
 
 func (w *fileLogWriter) renameFile(oldpath, newpath string, idx int) bool {
@@ -71,7 +111,8 @@ func (w *fileLogWriter) renameFile(oldpath, newpath string, idx int) bool {
 			filename = newpath[:len(newpath)-4] + fmt.Sprintf("_%d.log", idx)
 		}
 
-		if isFileExist(filename) {
+		// 已经压缩过的文件也要避开
+		if isFileExist(filename) || isFileExist(filename+kGzipSuffix) {
 			continue
 		}
 
@@ -81,41 +122,65 @@ func (w *fileLogWriter) renameFile(oldpath, newpath string, idx int) bool {
 		}
 		break
 	}
+
+	w.notifyBackground()
 	return true
 }
 
-func (w *fileLogWriter) rotateFile(now time.Time) bool {
+// 判断文件大小或行数是否到达上限，pending 为即将写入的字节数，空文件不轮转
+func (w *fileLogWriter) exceedLimit(size, lines, pending int64) bool {
+	return (w.maxsize > 0 && size > 0 && size+pending > w.maxsize) ||
+		(w.maxline > 0 && lines >= w.maxline)
+}
+
+// 关闭当前文件，需要轮转时重命名，然后重新打开
+// 文件已经打开时使用记录的大小和行数，否则从已存在的文件中统计
+func (w *fileLogWriter) rotateFile(now time.Time, pending int64) bool {
+	size, lines := w.currSize, w.currLines
 	if w.file != nil {
 		_ = w.file.Close()
 		w.file = nil
+	} else {
+		size, lines = 0, 0
 	}
 
-	// 计算当前时间是否到达更换文件时间
-	if w.rotate {
-		info, err := os.Stat(w.filename)
-		if err == nil { // 文件存在
+	info, err := os.Stat(w.filename)
+	if err == nil { // 文件存在
+		if size == 0 {
+			size = info.Size()
+			if w.maxline > 0 && size > 0 {
+				lines = countLines(w.filename)
+			}
+		}
+
+		// 计算当前时间是否到达更换文件时间
+		if w.rotate {
+			mtime := info.ModTime()
 			if w.daily {
 				// 按时间重命名文件， filename_20060102.log
 				// 如果存在重名，增加后缀 filename_20060102_n.log
-				mtime := info.ModTime()
-				// 此文件不是为当天的文件，或文件过大
+				// 此文件不是为当天的文件，或文件过大，或行数过多
 				if (mtime.Year() != now.Year() || mtime.YearDay() != now.YearDay()) ||
-					(w.maxsize > 0 && info.Size() > w.maxsize) {
+					w.exceedLimit(size, lines, pending) {
 					basename := w.filename[:len(w.filename)-4]
 					basename += fmt.Sprintf("_%s.log", mtime.Format("20060102"))
 					if !w.renameFile(w.filename, basename, 0) {
 						return false
 					}
+					size, lines = 0, 0
 				}
 			} else {
-				// 仅需判断文件大小，直接增加后缀
-				if w.maxsize > 0 && info.Size() > w.maxsize {
+				// 仅需判断文件大小和行数，直接增加后缀
+				if w.exceedLimit(size, lines, pending) {
 					if !w.renameFile(w.filename, w.filename, 1) {
 						return false
 					}
+					size, lines = 0, 0
 				}
 			}
 		}
+	} else {
+		size, lines = 0, 0
 	}
 
 	f, err := os.OpenFile(w.filename, os.O_APPEND|os.O_RDWR|os.O_CREATE, 0666)
@@ -124,56 +189,73 @@ func (w *fileLogWriter) rotateFile(now time.Time) bool {
 		return false
 	}
 	w.file = f
-	w.currSize = 0
+	w.currSize = size
+	w.currLines = lines
 	w.currDay = now.YearDay()
 
 	return true
 }
 
-func (w *fileLogWriter) ProcessMsg(msg *formattedRecord) bool {
+func (w *fileLogWriter) ProcessMsg(msg *FormattedRecord) bool {
+	line := msg.line()
+	pending := int64(len(line))
 	if w.file == nil {
-		if !w.rotateFile(msg.Created) {
+		if !w.rotateFile(msg.Created, pending) {
 			return false
 		}
-	}
-
-	if w.rotate {
-		if msg.Created.YearDay() != w.currDay ||
-			w.currSize+int64(len(msg.Formatted))+1 > w.maxsize {
-			if !w.rotateFile(msg.Created) {
+	} else if w.rotate {
+		if (w.daily && msg.Created.YearDay() != w.currDay) ||
+			w.exceedLimit(w.currSize, w.currLines, pending) {
+			if !w.rotateFile(msg.Created, pending) {
 				return false
 			}
 		}
 	}
 
-	if _, err := fmt.Fprintln(w.file, msg.Formatted); err != nil {
+	if _, err := w.file.Write(line); err != nil {
 		fmt.Println(err)
 		w.file.Close()
 		w.file = nil
 		return false
 	}
 
-	w.currSize += int64(len(msg.Formatted))
+	w.currSize += pending
+	w.currLines += int64(bytes.Count(line, []byte{'\n'}))
 	return true
 }
 
-func (w *fileLogWriter) Run() {
-	defer doRecover()
+func (w *fileLogWriter) process(rec *FormattedRecord) bool {
+	return w.ProcessMsg(rec)
+}
+
+// 关闭当前文件并按文件名重新打开，文件不存在时创建
+func (w *fileLogWriter) reopen() error {
+	if w.file != nil {
+		_ = w.file.Close()
+		w.file = nil
+	}
 
-	w.wg.Add(1)
-	w.opened = true
+	if !w.rotateFile(time.Now(), 0) {
+		return fmt.Errorf("reopen %s fail", w.filename)
+	}
+	return nil
+}
 
-	for msg := range w.ch {
-		w.ProcessMsg(msg)
+func (w *fileLogWriter) sync() error {
+	if w.file == nil {
+		return nil
 	}
+	return w.file.Sync()
+}
 
+func (w *fileLogWriter) close() {
 	if w.file != nil {
 		w.file.Close()
 		w.file = nil
 	}
 
-	w.opened = false
-	w.wg.Done()
+	if w.bgCh != nil {
+		close(w.bgCh)
+		w.bgWg.Wait()
+	}
 }
-
-//// ---------------------------------------------------
@@ -0,0 +1,89 @@
+package log4g
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func processLines(t *testing.T, w *fileLogWriter, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if !w.ProcessMsg(&FormattedRecord{Created: time.Now(), Formatted: []byte(line)}) {
+			t.Fatalf("write %q failed", line)
+		}
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFileMaxlineRotation(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "app.log")
+	w := &fileLogWriter{filename: filename, rotate: true, maxline: 2}
+	defer w.close()
+
+	processLines(t, w, "1", "2", "3", "4", "5")
+
+	if got, want := listDir(t, dir), []string{"app.log", "app_1.log", "app_2.log"}; !equalStrings(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for name, want := range map[string]string{"app_1.log": "1\n2\n", "app_2.log": "3\n4\n", "app.log": "5\n"} {
+		if got := readTestFile(t, filepath.Join(dir, name)); got != want {
+			t.Errorf("%s contains %q, want %q", name, got, want)
+		}
+	}
+}
+
+// 追加写入已存在的文件时，文件中已有的行也计入行数
+func TestFileMaxlineCountsExistingLines(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "app.log")
+	if err := ioutil.WriteFile(filename, []byte("old1\nold2\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &fileLogWriter{filename: filename, rotate: true, maxline: 3}
+	defer w.close()
+
+	processLines(t, w, "a", "b", "c")
+
+	if got, want := readTestFile(t, filepath.Join(dir, "app_1.log")), "old1\nold2\na\n"; got != want {
+		t.Errorf("app_1.log contains %q, want %q", got, want)
+	}
+	if got, want := readTestFile(t, filename), "b\nc\n"; got != want {
+		t.Errorf("app.log contains %q, want %q", got, want)
+	}
+
+	// 已经到达上限的文件在打开时直接轮转
+	w.close()
+	processLines(t, w, "d", "e", "f", "g")
+	if got, want := readTestFile(t, filepath.Join(dir, "app_2.log")), "b\nc\nd\n"; got != want {
+		t.Errorf("app_2.log contains %q, want %q", got, want)
+	}
+	if got, want := readTestFile(t, filename), "e\nf\ng\n"; got != want {
+		t.Errorf("app.log contains %q, want %q", got, want)
+	}
+
+	w.close()
+	processLines(t, w, "h")
+	if got, want := readTestFile(t, filepath.Join(dir, "app_3.log")), "e\nf\ng\n"; got != want {
+		t.Errorf("app_3.log contains %q, want %q", got, want)
+	}
+	if got, want := readTestFile(t, filename), "h\n"; got != want {
+		t.Errorf("app.log contains %q, want %q", got, want)
+	}
+}
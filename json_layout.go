@@ -0,0 +1,222 @@
+package log4g
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const kDefaultJsonTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+type jsonKey int
+
+const (
+	kJsonTime jsonKey = iota
+	kJsonLevel
+	kJsonCategory
+	kJsonFile
+	kJsonLine
+	kJsonFunction
+	kJsonThread
+	kJsonMessage
+	kJsonFields
+	kJsonKeyCount
+)
+
+// json 布局中可配置的字段，以及默认输出的字段名，配置时使用前者作为 key
+var kJsonKeys = [kJsonKeyCount][2]string{
+	{"time", "time"},
+	{"level", "level"},
+	{"category", "category"},
+	{"file", "file"},
+	{"line", "line"},
+	{"function", "func"},
+	{"thread", "goroutine"},
+	{"message", "message"},
+	{"fields", "fields"}, // With 添加的结构化字段，作为一个对象输出
+}
+
+/**
+ * json 布局，每条日志输出为一行 json 对象
+ */
+type jsonLayout struct {
+	timeFormat *timeFormatter
+	names      [kJsonKeyCount]string // 输出的字段名，为空时不输出
+}
+
+func newJsonLayout(timeFormat string, names map[string]string) (*jsonLayout, error) {
+	if timeFormat == "" {
+		timeFormat = kDefaultJsonTimeFormat
+	}
+	jl := &jsonLayout{timeFormat: newTimeFormatter(timeFormat)}
+
+	for i, key := range kJsonKeys {
+		jl.names[i] = key[1]
+	}
+
+	for key, name := range names {
+		idx := -1
+		for i := range kJsonKeys {
+			if kJsonKeys[i][0] == key {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, fmt.Errorf("unknown json layout field %s", key)
+		}
+
+		if name == "-" {
+			name = ""
+		}
+		jl.names[idx] = name
+	}
+
+	return jl, nil
+}
+
+// 输出的字段需要的日志源信息
+func (jl *jsonLayout) needs() sourceNeeds {
+	needs := sourceNeeds(0)
+	if jl.names[kJsonFile] != "" || jl.names[kJsonLine] != "" || jl.names[kJsonFunction] != "" {
+		needs |= kNeedCaller
+	}
+	if jl.names[kJsonThread] != "" {
+		needs |= kNeedGoroutine
+	}
+	return needs
+}
+
+func (jl *jsonLayout) appendRecord(buf []byte, rec *logRecord) []byte {
+	buf = append(buf, '{')
+
+	first := true
+	key := func(k jsonKey) bool {
+		if jl.names[k] == "" {
+			return false
+		}
+		if !first {
+			buf = append(buf, ',')
+		}
+		first = false
+		buf = appendJsonString(buf, jl.names[k])
+		buf = append(buf, ':')
+		return true
+	}
+
+	if key(kJsonTime) {
+		buf = append(buf, '"')
+		buf = jl.timeFormat.appendTime(buf, rec.Created)
+		buf = append(buf, '"')
+	}
+	if key(kJsonLevel) {
+		buf = appendJsonString(buf, strings.TrimSpace(rec.Level.LongString()))
+	}
+	if key(kJsonCategory) {
+		buf = appendJsonString(buf, rec.Category)
+	}
+	if key(kJsonFile) {
+		buf = appendJsonString(buf, path.Base(rec.Source.File))
+	}
+	if key(kJsonLine) {
+		buf = strconv.AppendInt(buf, int64(rec.Source.Line), 10)
+	}
+	if key(kJsonFunction) {
+		buf = appendJsonString(buf, shortFuncName(rec.Source.Func))
+	}
+	if key(kJsonThread) {
+		buf = strconv.AppendUint(buf, rec.Source.Tid, 10)
+	}
+	if key(kJsonMessage) {
+		buf = appendJsonString(buf, rec.Message)
+	}
+	if len(rec.Fields) > 0 && key(kJsonFields) {
+		buf = append(buf, '{')
+		for i, f := range rec.Fields {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendJsonString(buf, f.Key)
+			buf = append(buf, ':')
+			buf = appendJsonValue(buf, f.Value)
+		}
+		buf = append(buf, '}')
+	}
+
+	return append(buf, '}')
+}
+
+// 输出字段值，error 输出为错误信息，无法编码为 json 的值使用 fmt.Sprint 转为字符串
+func appendJsonValue(buf []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case string:
+		return appendJsonString(buf, v)
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(buf, v, 10)
+	case uint64:
+		return strconv.AppendUint(buf, v, 10)
+	case bool:
+		return strconv.AppendBool(buf, v)
+	case error:
+		return appendJsonString(buf, v.Error())
+	}
+
+	out := bytes.Buffer{}
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return appendJsonString(buf, fmt.Sprint(v))
+	}
+	return append(buf, bytes.TrimRight(out.Bytes(), "\n")...)
+}
+
+const kHexDigits = "0123456789abcdef"
+
+// 输出带引号的 json 字符串，转义引号、反斜杠和控制字符，非法的 utf8 替换为 �
+func appendJsonString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' {
+				i++
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				buf = append(buf, '\\', b)
+			case '\n':
+				buf = append(buf, `\n`...)
+			case '\r':
+				buf = append(buf, `\r`...)
+			case '\t':
+				buf = append(buf, `\t`...)
+			default:
+				buf = append(buf, `\u00`...)
+				buf = append(buf, kHexDigits[b>>4], kHexDigits[b&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, `�`...)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buf = append(buf, s[start:]...)
+	return append(buf, '"')
+}
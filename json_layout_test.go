@@ -0,0 +1,75 @@
+package log4g
+
+import (
+	"encoding/json"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestAppendJsonString(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string // 输出的 json 字符串
+		decoded string // json 解析后的值
+	}{
+		{"plain", `"plain"`, "plain"},
+		{"", `""`, ""},
+		{`say "hi"`, `"say \"hi\""`, `say "hi"`},
+		{`C:\dir`, `"C:\\dir"`, `C:\dir`},
+		{"a\nb\r\tc", `"a\nb\r\tc"`, "a\nb\r\tc"},
+		{"\x00\x01\x1f", `"\u0000\u0001\u001f"`, "\x00\x01\x1f"},
+		{"\x7f", "\"\x7f\"", "\x7f"},
+		{"中文 ü", `"中文 ü"`, "中文 ü"},
+		{"bad\xffbyte", "\"bad\ufffdbyte\"", "bad\ufffdbyte"},
+		{"\xe4\xb8", "\"\ufffd\ufffd\"", "\ufffd\ufffd"}, // 截断的多字节字符
+	}
+
+	for _, test := range tests {
+		got := string(appendJsonString(nil, test.in))
+		if got != test.want {
+			t.Errorf("appendJsonString(%q) = %s, want %s", test.in, got, test.want)
+			continue
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("appendJsonString(%q) = %q is not valid UTF-8", test.in, got)
+		}
+
+		var decoded string
+		if err := json.Unmarshal([]byte(got), &decoded); err != nil {
+			t.Errorf("appendJsonString(%q) = %s is not valid json: %v", test.in, got, err)
+		} else if decoded != test.decoded {
+			t.Errorf("appendJsonString(%q) decodes to %q, want %q", test.in, decoded, test.decoded)
+		}
+	}
+}
+
+func TestJsonLayoutRecord(t *testing.T) {
+	layout, err := newLayoutFromCfg(layoutSecCfg{
+		Type:       kJsonLayoutType,
+		TimeFormat: "15:04:05",
+		Fields:     map[string]string{"message": "msg", "thread": "-"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := newTestRecord()
+	rec.Message = "line1\n\"quoted\"\x02"
+	rec.Fields = []field{{Key: "user", Value: "a\"b"}, {Key: "n", Value: 3}}
+	buf, _ := appendRecord(nil, nil, rec, layout)
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf, &got); err != nil {
+		t.Fatalf("record %s is not valid json: %v", buf, err)
+	}
+	if got["msg"] != rec.Message || got["time"] != "15:04:05" || got["line"] != float64(42) {
+		t.Fatalf("unexpected record %s", buf)
+	}
+	if _, ok := got["goroutine"]; ok {
+		t.Fatalf("omitted thread key is present: %s", buf)
+	}
+	fields, _ := got["fields"].(map[string]interface{})
+	if fields["user"] != "a\"b" || fields["n"] != float64(3) {
+		t.Fatalf("unexpected fields in %s", buf)
+	}
+}
@@ -0,0 +1,104 @@
+package log4g
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// 运行时修改分类在配置中的所有过滤器的等级，重新加载配置后恢复为配置中的等级
+// 只修改分类自己的过滤器，继承这些过滤器的子分类一起变化，分类没有配置过滤器时返回错误，不修改父分类或根分类
+func SetLevel(category string, level Level) error {
+	filters, err := configuredFilters(category)
+	if err != nil {
+		return err
+	}
+	for _, f := range filters {
+		f.setLevel(level)
+	}
+	updateMinLevels()
+	return nil
+}
+
+// 获取分类输出的最低等级，即分类实际使用的所有过滤器中最低的等级，包括继承的过滤器
+func GetLevel(category string) Level {
+	level := CRITICAL
+	for _, f := range resolvedFilters(category) {
+		if l := f.getLevel(); l < level {
+			level = l
+		}
+	}
+	return level
+}
+
+// 运行时修改分类在配置中的单个过滤器的等级，filter 为配置中的 name ，或者过滤器的序号(从 0 开始)
+func SetFilterLevel(category, filter string, level Level) error {
+	f, err := lookupFilter(category, filter)
+	if err != nil {
+		return err
+	}
+	f.setLevel(level)
+	updateMinLevels()
+	return nil
+}
+
+func GetFilterLevel(category, filter string) (Level, error) {
+	f, err := lookupFilter(category, filter)
+	if err != nil {
+		return DEBUG, err
+	}
+	return f.getLevel(), nil
+}
+
+// 过滤器的等级变化后，重新计算所有分类的最低等级，过滤器可能被多个分类共享
+func updateMinLevels() {
+	gLoggerMu.Lock()
+	defer gLoggerMu.Unlock()
+
+	for _, c := range gLoggerMgr {
+		c.updateMinLevel()
+	}
+}
+
+// 查找已注册的分类，不注册新分类
+func findCategory(name string) (*category, bool) {
+	gLoggerMu.Lock()
+	defer gLoggerMu.Unlock()
+	c, ok := gLoggerMgr[name]
+	return c, ok
+}
+
+// 分类实际使用的过滤器，分类没有注册时按当前配置计算，不注册分类
+func resolvedFilters(category string) []*categoryFilter {
+	if c, ok := findCategory(category); ok {
+		return c.getFilters()
+	}
+	return currentCategoryTree().resolve(category)
+}
+
+// 分类在当前配置中自己的过滤器，不包括继承的过滤器
+func configuredFilters(category string) ([]*categoryFilter, error) {
+	filters, ok := currentCategoryTree().filters[category]
+	if !ok {
+		return nil, fmt.Errorf("category %s not configured", category)
+	}
+	return filters, nil
+}
+
+// 在分类自己的过滤器中先按名称查找，找不到时把 filter 作为序号
+func lookupFilter(category, filter string) (*categoryFilter, error) {
+	filters, err := configuredFilters(category)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range filters {
+		if f.name != "" && f.name == filter {
+			return f, nil
+		}
+	}
+
+	idx, err := strconv.Atoi(filter)
+	if err != nil || idx < 0 || idx >= len(filters) {
+		return nil, fmt.Errorf("filter %s not found in category %s", filter, category)
+	}
+	return filters[idx], nil
+}
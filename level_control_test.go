@@ -0,0 +1,65 @@
+package log4g
+
+import "testing"
+
+const kLevelTestConfig = `{
+	"categories": {
+		"root": {"enable": true, "filters": [{"level": "INFO", "output": ["console"]}]},
+		"level_test": {"enable": true, "filters": [
+			{"name": "main", "level": "INFO", "output": ["console"]},
+			{"name": "audit", "level": "ERROR", "output": ["console"]}
+		]}
+	}
+}`
+
+func TestSetLevelOwnFilters(t *testing.T) {
+	if err := LoadJsonString(kLevelTestConfig); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	child := GetLogger("level_test.child")
+	if err := SetLevel("level_test", DEBUG); err != nil {
+		t.Fatal(err)
+	}
+	for _, filter := range []string{"main", "audit"} {
+		if level, _ := GetFilterLevel("level_test", filter); level != DEBUG {
+			t.Fatalf("filter %s level is %v, want DEBUG", filter, level)
+		}
+	}
+	// 子分类继承父分类的过滤器
+	if !child.IsEnabled(DEBUG) || GetLevel("level_test.child") != DEBUG {
+		t.Fatal("child category did not follow its parent")
+	}
+	if GetLevel("root") != INFO {
+		t.Fatalf("root level changed to %v", GetLevel("root"))
+	}
+}
+
+// 没有配置过滤器的分类返回错误，不修改父分类或根分类
+func TestSetLevelUnconfigured(t *testing.T) {
+	if err := LoadJsonString(kLevelTestConfig); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	other := GetLogger("level_other")
+	for _, name := range []string{"payments", "level_test.child"} {
+		if err := SetLevel(name, DEBUG); err == nil {
+			t.Errorf("SetLevel(%s) succeeded, want error", name)
+		}
+		if err := SetFilterLevel(name, "0", DEBUG); err == nil {
+			t.Errorf("SetFilterLevel(%s) succeeded, want error", name)
+		}
+	}
+
+	if GetLevel("root") != INFO || other.IsEnabled(DEBUG) {
+		t.Fatal("root filters changed")
+	}
+	if GetLevel("level_test") != INFO {
+		t.Fatal("parent filters changed")
+	}
+	if _, ok := findCategory("payments"); ok {
+		t.Fatal("SetLevel registered the category")
+	}
+}
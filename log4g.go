@@ -6,22 +6,36 @@ package log4g
 type Logger interface {
 	Critical(args ...interface{})
 	CriticalF(format string, args ...interface{})
+	CriticalFn(fn func() string)
 
 	Error(args ...interface{})
 	ErrorF(format string, args ...interface{})
+	ErrorFn(fn func() string)
 
 	Warn(args ...interface{})
 	WarnF(format string, args ...interface{})
+	WarnFn(fn func() string)
 
 	Info(args ...interface{})
 	InfoF(format string, args ...interface{})
+	InfoFn(fn func() string)
 
 	Debug(args ...interface{})
 	DebugF(format string, args ...interface{})
+	DebugFn(fn func() string)
 
 	Trace(args ...interface{})
 	TraceF(format string, args ...interface{})
+	TraceFn(fn func() string)
 
 	Log(level Level, args ...interface{})
 	LogF(level Level, format string, args ...interface{})
+	LogFn(level Level, fn func() string) // fn 只在等级会被输出时调用，用于生成代价较高的日志
+
+	// 是否有过滤器会输出此等级的日志
+	IsEnabled(level Level) bool
+
+	// 返回携带结构化字段的子 Logger ，kv 为交替的键和值，子 Logger 与父 Logger 共享过滤器和输出
+	// 	eg. lg.With("reqid", id, "uid", uid).Info("done")
+	With(kv ...interface{}) Logger
 }
@@ -0,0 +1,66 @@
+package log4g
+
+import "testing"
+
+// 基准测试用的输出，只归还记录，测量的是日志调用本身的开销
+type nopWriter struct{}
+
+func (nopWriter) Write(rec *FormattedRecord) {
+	rec.Release()
+}
+
+func (nopWriter) Close() {
+}
+
+func init() {
+	RegisterWriterType("bench_nop", func(_ string, _ map[string]interface{}) (Writer, error) {
+		return nopWriter{}, nil
+	})
+}
+
+const kBenchConfig = `{
+	"files": {"nop": {"type": "bench_nop"}},
+	"layouts": {
+		"plain": "[%T] %L %C %M",
+		"source": "[%T] %L %C (%S) %G %M",
+		"json_no_source": {"type": "json", "fields": {"file": "-", "line": "-", "function": "-", "thread": "-"}}
+	},
+	"categories": {
+		"bench.plain": {"enable": true, "filters": [{"layout": "plain", "output": ["nop"]}]},
+		"bench.source": {"enable": true, "filters": [{"layout": "source", "output": ["nop"]}]},
+		"bench.json": {"enable": true, "filters": [{"layout": "json_no_source", "output": ["nop"]}]},
+		"bench.disabled": {"enable": true, "filters": [{"level": "ERROR", "layout": "source", "output": ["nop"]}]}
+	}
+}`
+
+func benchmarkInfo(b *testing.B, category string) {
+	if err := LoadJsonString(kBenchConfig); err != nil {
+		b.Fatal(err)
+	}
+	defer Close()
+
+	l := GetLogger(category)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Info("hello world")
+	}
+}
+
+func BenchmarkPlainLayout(b *testing.B) {
+	benchmarkInfo(b, "bench.plain")
+}
+
+// %S 和 %G 需要获取调用位置和协程 id
+func BenchmarkSourceLayout(b *testing.B) {
+	benchmarkInfo(b, "bench.source")
+}
+
+func BenchmarkJsonLayoutNoSource(b *testing.B) {
+	benchmarkInfo(b, "bench.json")
+}
+
+// 低于过滤器等级，不格式化也不获取调用位置
+func BenchmarkDisabledLevel(b *testing.B) {
+	benchmarkInfo(b, "bench.disabled")
+}
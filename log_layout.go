@@ -1,8 +1,9 @@
 package log4g
 
 import (
-	"bytes"
 	"fmt"
+	"path"
+	"strconv"
 	"strings"
 )
 
@@ -17,27 +18,99 @@ const (
 	kTime
 	kString
 	kGoroutineID
+	kFields
+	kFile
+	kLine
+	kFunction
+	kColorStart
+	kColorEnd
 )
 
 const (
 	kDefaultLayout         = "[%T] %L %C (%S) %M"
- 	kDefaultDatetimeFormat = "2006-01-02 15:04:05.000"
+	kDefaultDatetimeFormat = "2006-01-02 15:04:05.000"
 )
 
-var gDefaultLayout = newLayoutConf(kDefaultLayout)
+const kDefaultLayoutName = "default"
+
+var gDefaultLayout = func() *layoutInfo {
+	layout := mustNewLayoutConf(kDefaultLayout)
+	layout.Name = kDefaultLayoutName
+	return layout
+}()
+
+// 内置的布局，任何配置中都可以直接使用，layouts 段中配置了同名的布局时使用配置的布局
+var kBuiltinLayouts = map[string]layoutSecCfg{
+	kDefaultLayoutName: {Pattern: kDefaultLayout},
+	kLogfmtLayoutType:  {Type: kLogfmtLayoutType},
+	kJsonLayoutType:    {Type: kJsonLayoutType},
+}
+
+// 按名称查找布局配置，先查找配置中的布局，再查找内置的布局，名称为空时为 default
+func lookupLayoutCfg(layouts map[string]layoutSecCfg, name string) (string, layoutSecCfg, bool) {
+	if name == "" {
+		name = kDefaultLayoutName
+	}
+	if cfg, ok := layouts[name]; ok {
+		return name, cfg, true
+	}
+	cfg, ok := kBuiltinLayouts[name]
+	return name, cfg, ok
+}
 
 type section struct {
-	T sectionType
-	V string
+	T    sectionType
+	V    string // 时间格式，或者原样输出的字符串
+	F    string // Sprintf 格式，为空时直接输出
+	Long bool   // 文件输出完整路径，函数输出包含包路径的完整名称
+
+	Time *timeFormatter // 时间段的格式化对象，按秒缓存格式化结果
 }
 
 type layoutInfo struct {
+	Name     string // 配置中的名称
 	Sections []section
+	Json     *jsonLayout   // 不为空时输出 json 格式，忽略 Sections
+	Logfmt   *logfmtLayout // 不为空时输出 logfmt 格式，忽略 Sections
+	Needs    sourceNeeds   // 格式化时需要的日志源信息，创建日志记录时只获取这些信息
+	Fields   bool          // 布局中有 %F 或 %{fields} ，没有时字段输出在消息之后
+}
+
+const (
+	kTextLayoutType   = "text"
+	kJsonLayoutType   = "json"
+	kLogfmtLayoutType = "logfmt"
+)
+
+// 布局类型，text 、 json 或 logfmt
+func (l *layoutInfo) layoutType() string {
+	switch {
+	case l.Json != nil:
+		return kJsonLayoutType
+	case l.Logfmt != nil:
+		return kLogfmtLayoutType
+	}
+	return kTextLayoutType
+}
+
+func newLayoutFromCfg(cfg layoutSecCfg) (*layoutInfo, error) {
+	switch cfg.Type {
+	case "", kTextLayoutType:
+		return newLayoutConf(cfg.Pattern)
+	case kJsonLayoutType:
+		jl, err := newJsonLayout(cfg.TimeFormat, cfg.Fields)
+		if err != nil {
+			return nil, err
+		}
+		return &layoutInfo{Json: jl, Needs: jl.needs()}, nil
+	case kLogfmtLayoutType:
+		return &layoutInfo{Logfmt: newLogfmtLayout(cfg.TimeFormat)}, nil
+	}
+	return nil, fmt.Errorf("unknown layout type %s", cfg.Type)
 }
 
 /**
- * TODO:
- * %{section:format} 	section is required, must be one of (time level category file line function thread message),
+ * %{section:format} 	section is required, must be one of (time level category file line function thread message fields color reset),
  * 						format is optional
  *
  * - time		: datetime, format must be valid datetime format,
@@ -54,23 +127,33 @@ type layoutInfo struct {
  *					default format is 'short;%s'
  * - thread     : goroutines id, format is ignored
  * - message    : output message, format is ignored
+ * - fields     : structured fields added by Logger.With, format is ignored,
+ *					layouts without this section print the fields after the message
+ * - color      : start coloring by level on consoles with color enabled, format is ignored
+ * - reset      : stop coloring, format is ignored, without it the color lasts to the end of line
+ *					eg. "[%{time}] %{color}%{level:long}%{reset} %{message}"
+ *					without any color section, console colors the whole line
  *
- * Ignores unknown formats
+ * Unknown sections and invalid formats are errors
  * Recommended: "[%{time}] %{level} %{category} (%{file}:%{line}) %{message}"
  */
 
 // Known format codes:
 // %T - DateTime with format string, default format is '2006-01-03 15:04:05.000'
-//  	eg. %T{2006-01-02 15:04:05}
+//
+//	eg. %T{2006-01-02 15:04:05}
+//
 // %L - Level (DEBG, TRAC, WARN, EROR, CRIT)
 // %l - Level (D, T, W, E, C)
 // %C - category
 // %S - Source filename:line
 // %G - GoroutineID
 // %M - Message
+// %F - Structured fields added by Logger.With (k1=v1 k2=v2), without %F they follow %M
+// %{...} - See above
 // Ignores unknown formats
 // Recommended: "[%T] %L %C (%S) %M"
-func newLayoutConf(layout string) *layoutInfo {
+func newLayoutConf(layout string) (*layoutInfo, error) {
 	lc := &layoutInfo{}
 
 	// 1. 找到 '%' ，将字符串分割为前后两段， prefix / suffix
@@ -87,17 +170,33 @@ func newLayoutConf(layout string) *layoutInfo {
 	//		S: 日志源
 	//		G: go协程ID
 	//		M: 日志信息
+	//		F: 结构化字段
+	//		{: 找到 '}'，解析其中的 section:format
 	//		%: 将字符 '%' 追加到 prefix 上
 	//		其他: 将 '%' 和 ch 追加到 prefix 上
 
 	prefix := ""
 	suffix := layout
-	add := func(t sectionType, v string) {
+	addSection := func(sec section) {
+		if sec.T == kTime {
+			sec.Time = newTimeFormatter(sec.V)
+		}
 		if len(prefix) > 0 {
 			lc.Sections = append(lc.Sections, section{T: kString, V: prefix})
 			prefix = ""
 		}
-		lc.Sections = append(lc.Sections, section{T: t, V: v})
+		lc.Sections = append(lc.Sections, sec)
+		switch sec.T {
+		case kSource, kFile, kLine, kFunction:
+			lc.Needs |= kNeedCaller
+		case kGoroutineID:
+			lc.Needs |= kNeedGoroutine
+		case kFields:
+			lc.Fields = true
+		}
+	}
+	add := func(t sectionType, v string) {
+		addSection(section{T: t, V: v})
 	}
 
 	for {
@@ -137,6 +236,19 @@ func newLayoutConf(layout string) *layoutInfo {
 			add(kGoroutineID, "")
 		case 'M':
 			add(kMsg, "")
+		case 'F':
+			add(kFields, "")
+		case '{':
+			idx := strings.IndexByte(suffix, '}')
+			if idx < 0 {
+				return nil, fmt.Errorf("unclosed section %%{%s", suffix)
+			}
+			sec, err := parseSection(suffix[:idx])
+			if err != nil {
+				return nil, err
+			}
+			suffix = suffix[idx+1:]
+			addSection(sec)
 		case '%':
 			prefix += "%"
 		default:
@@ -144,9 +256,98 @@ func newLayoutConf(layout string) *layoutInfo {
 		}
 	}
 
+	return lc, nil
+}
+
+func mustNewLayoutConf(layout string) *layoutInfo {
+	lc, err := newLayoutConf(layout)
+	if err != nil {
+		panic(err)
+	}
 	return lc
 }
 
+// 解析 %{section:format} 中括号内的部分
+func parseSection(content string) (section, error) {
+	name, format := content, ""
+	hasFormat := false
+	if idx := strings.IndexByte(content, ':'); idx >= 0 {
+		name, format, hasFormat = content[:idx], content[idx+1:], true
+	}
+
+	switch name {
+	case "time":
+		if !hasFormat || format == "" {
+			format = kDefaultDatetimeFormat
+		}
+		return section{T: kTime, V: format}, nil
+	case "level":
+		switch format {
+		case "", "short":
+			return section{T: kShortLevel}, nil
+		case "long":
+			return section{T: kLongLevel}, nil
+		}
+		return section{}, fmt.Errorf("invalid level format '%s', must be long or short", format)
+	case "category":
+		f, err := checkFormat(name, format, "%s", "x")
+		return section{T: kCategory, F: f}, err
+	case "file", "function":
+		long, f, err := parseLongShortFormat(name, format)
+		t := kFile
+		if name == "function" {
+			t = kFunction
+		}
+		return section{T: t, F: f, Long: long}, err
+	case "line":
+		f, err := checkFormat(name, format, "%d", 1)
+		return section{T: kLine, F: f}, err
+	case "thread":
+		return section{T: kGoroutineID}, nil
+	case "message":
+		return section{T: kMsg}, nil
+	case "fields":
+		return section{T: kFields}, nil
+	case "color":
+		return section{T: kColorStart}, nil
+	case "reset":
+		return section{T: kColorEnd}, nil
+	}
+
+	return section{}, fmt.Errorf("unknown section '%s'", name)
+}
+
+// 解析 <long|short>[;string-format] 格式
+func parseLongShortFormat(name, format string) (long bool, f string, err error) {
+	mode := format
+	if idx := strings.IndexByte(format, ';'); idx >= 0 {
+		mode, f = format[:idx], format[idx+1:]
+	}
+
+	switch mode {
+	case "", "short":
+	case "long":
+		long = true
+	default:
+		return false, "", fmt.Errorf("invalid %s format '%s', must be long or short", name, format)
+	}
+
+	f, err = checkFormat(name, f, "%s", "x")
+	return long, f, err
+}
+
+// 检查 Sprintf 格式能否正确格式化 sample 类型的值，默认格式 def 返回空字符串，输出时无需格式化
+func checkFormat(name, format, def string, sample interface{}) (string, error) {
+	if format == "" || format == def {
+		return "", nil
+	}
+
+	if s := fmt.Sprintf(format, sample); strings.Contains(s, "%!") {
+		return "", fmt.Errorf("invalid %s format '%s'", name, format)
+	}
+	return format, nil
+}
+
 func getTimeFormat(layout string) (format string, newLayout string) {
 	format = kDefaultDatetimeFormat
 	newLayout = layout
@@ -165,33 +366,126 @@ func getTimeFormat(layout string) (format string, newLayout string) {
 	return
 }
 
-func recordFormatToString(rec *logRecord, layout *layoutInfo) string {
+// 按布局格式化日志，追加到 buf 中，除自定义的 Sprintf 格式和字段值外不分配内存
+// 着色的起止位置追加到 spans 中，位置相对于 buf 的开头
+func appendRecord(buf []byte, spans []int, rec *logRecord, layout *layoutInfo) ([]byte, []int) {
 	if rec == nil || layout == nil {
-		return "<nil>"
+		return append(buf, "<nil>"...), spans
 	}
 
-	out := bytes.NewBuffer(make([]byte, 0, 64))
+	if layout.Json != nil {
+		return layout.Json.appendRecord(buf, rec), spans
+	}
+	if layout.Logfmt != nil {
+		return layout.Logfmt.appendRecord(buf, rec), spans
+	}
 
 	for i := 0; i < len(layout.Sections); i++ {
-		switch layout.Sections[i].T {
+		sec := &layout.Sections[i]
+		switch sec.T {
 		case kTime:
-			out.WriteString(rec.Created.Format(layout.Sections[i].V))
+			buf = sec.Time.appendTime(buf, rec.Created)
 		case kCategory:
-			out.WriteString(rec.Category)
+			buf = appendFormatted(buf, sec.F, rec.Category)
 		case kLongLevel:
-			out.WriteString(rec.Level.LongString())
+			buf = append(buf, rec.Level.LongString()...)
 		case kShortLevel:
-			out.WriteString(rec.Level.ShortString())
+			buf = append(buf, rec.Level.ShortString()...)
 		case kSource:
-			out.WriteString(fmt.Sprintf("%s:%d", rec.Source.File, rec.Source.Line))
+			buf = append(buf, path.Base(rec.Source.File)...)
+			buf = append(buf, ':')
+			buf = strconv.AppendInt(buf, int64(rec.Source.Line), 10)
+		case kFile:
+			file := rec.Source.File
+			if !sec.Long {
+				file = path.Base(file)
+			}
+			buf = appendFormatted(buf, sec.F, file)
+		case kLine:
+			if sec.F != "" {
+				buf = append(buf, fmt.Sprintf(sec.F, rec.Source.Line)...)
+			} else {
+				buf = strconv.AppendInt(buf, int64(rec.Source.Line), 10)
+			}
+		case kFunction:
+			fn := rec.Source.Func
+			if !sec.Long {
+				fn = shortFuncName(fn)
+			}
+			buf = appendFormatted(buf, sec.F, fn)
 		case kGoroutineID:
-			out.WriteString(fmt.Sprintf("%016x", rec.Source.Tid))
+			buf = appendHex16(buf, rec.Source.Tid)
 		case kMsg:
-			out.WriteString(rec.Message)
+			buf = append(buf, rec.Message...)
+			if !layout.Fields && len(rec.Fields) > 0 {
+				buf = append(buf, ' ')
+				buf = appendFieldsText(buf, rec.Fields)
+			}
+		case kFields:
+			buf = appendFieldsText(buf, rec.Fields)
 		case kString:
-			out.WriteString(layout.Sections[i].V)
+			buf = append(buf, sec.V...)
+		case kColorStart:
+			if len(spans)%2 == 0 {
+				spans = append(spans, len(buf))
+			}
+		case kColorEnd:
+			if len(spans)%2 == 1 {
+				spans = append(spans, len(buf))
+			}
+		}
+	}
+
+	return buf, spans
+}
+
+func appendFormatted(buf []byte, format string, s string) []byte {
+	if format == "" {
+		return append(buf, s...)
+	}
+	return append(buf, fmt.Sprintf(format, s)...)
+}
+
+// 按 %016x 的格式输出
+func appendHex16(buf []byte, n uint64) []byte {
+	var tmp [16]byte
+	for i := 15; i >= 0; i-- {
+		tmp[i] = kHexDigits[n&0xf]
+		n >>= 4
+	}
+	return append(buf, tmp[:]...)
+}
+
+// 按 k1=v1 k2=v2 的格式输出字段，值包含空白、引号、'=' 或为空时加引号
+func appendFieldsText(buf []byte, fields []field) []byte {
+	for i, f := range fields {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, f.Key...)
+		buf = append(buf, '=')
+
+		switch v := f.Value.(type) {
+		case int:
+			buf = strconv.AppendInt(buf, int64(v), 10)
+		case int64:
+			buf = strconv.AppendInt(buf, v, 10)
+		case uint64:
+			buf = strconv.AppendUint(buf, v, 10)
+		case bool:
+			buf = strconv.AppendBool(buf, v)
+		case string:
+			buf = appendFieldValue(buf, v)
+		default:
+			buf = appendFieldValue(buf, fmt.Sprint(v))
 		}
 	}
+	return buf
+}
 
-	return out.String()
+func appendFieldValue(buf []byte, v string) []byte {
+	if v == "" || strings.ContainsAny(v, " \t\r\n\"=") {
+		return strconv.AppendQuote(buf, v)
+	}
+	return append(buf, v...)
 }
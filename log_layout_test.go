@@ -0,0 +1,174 @@
+package log4g
+
+import (
+	"testing"
+	"time"
+)
+
+// 测试用的日志记录，各个段的值固定
+func newTestRecord() *logRecord {
+	return &logRecord{
+		Category: "db",
+		Level:    WARNING,
+		Created:  time.Date(2026, 1, 2, 15, 4, 5, 678000000, time.Local),
+		Message:  "hello",
+		Source: logSource{
+			File: "/src/app/db/conn.go",
+			Line: 42,
+			Func: "example.com/app/db.(*Conn).Query",
+			Tid:  0x1f,
+		},
+	}
+}
+
+func formatLayout(t *testing.T, pattern string, rec *logRecord) string {
+	t.Helper()
+	layout, err := newLayoutConf(pattern)
+	if err != nil {
+		t.Fatalf("layout %q: %v", pattern, err)
+	}
+	buf, _ := appendRecord(nil, nil, rec, layout)
+	return string(buf)
+}
+
+func TestLayoutFields(t *testing.T) {
+	rec := newTestRecord()
+	rec.Fields = []field{{Key: "k", Value: "v"}, {Key: "n", Value: 1}}
+
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"%M", "hello k=v n=1"},
+		{"%C: %M.", "db: hello k=v n=1."},
+		{"%M [%F]", "hello [k=v n=1]"},
+		{"%{message} %{fields}", "hello k=v n=1"},
+		{"%C", "db"},
+	}
+	for _, test := range tests {
+		if got := formatLayout(t, test.pattern, rec); got != test.want {
+			t.Errorf("layout %q: got %q, want %q", test.pattern, got, test.want)
+		}
+	}
+
+	rec.Fields = nil
+	if got := formatLayout(t, "%M", rec); got != "hello" {
+		t.Errorf("no fields: got %q", got)
+	}
+}
+
+func TestLayoutSections(t *testing.T) {
+	rec := newTestRecord()
+
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		// 单字母格式
+		{"%T", "2026-01-02 15:04:05.678"},
+		{"%T{15:04:05}", "15:04:05"},
+		{"%L|%l", "WARN |W"},
+		{"%C", "db"},
+		{"%S", "conn.go:42"},
+		{"%G", "000000000000001f"},
+		{"%M", "hello"},
+		{"100%% %x", "100% %x"},
+
+		// %{section:format}
+		{"%{time}", "2026-01-02 15:04:05.678"},
+		{"%{time:}", "2026-01-02 15:04:05.678"},
+		{"%{time:2006/01/02}", "2026/01/02"},
+		{"%{level}", "W"},
+		{"%{level:short}", "W"},
+		{"%{level:long}", "WARN "},
+		{"%{category}", "db"},
+		{"%{line}", "42"},
+		{"%{thread}", "000000000000001f"},
+		{"%{message}", "hello"},
+
+		// 宽度和对齐
+		{"[%{category:%6s}]", "[    db]"},
+		{"[%{category:%-6s}]", "[db    ]"},
+		{"[%{line:%04d}]", "[0042]"},
+		{"[%{line:%-4d}]", "[42  ]"},
+		{"[%{file:short;%10s}]", "[   conn.go]"},
+		{"[%{function:short;%-7s}]", "[Query  ]"},
+
+		// 文件和函数的长短名称
+		{"%{file}", "conn.go"},
+		{"%{file:short}", "conn.go"},
+		{"%{file:long}", "/src/app/db/conn.go"},
+		{"%{function}", "Query"},
+		{"%{function:short}", "Query"},
+		{"%{function:long}", "example.com/app/db.(*Conn).Query"},
+		{"%{function:long;[%s]}", "[example.com/app/db.(*Conn).Query]"},
+
+		// 着色段本身不输出内容
+		{"%{color}%{level:long}%{reset} %M", "WARN  hello"},
+	}
+	for _, test := range tests {
+		if got := formatLayout(t, test.pattern, rec); got != test.want {
+			t.Errorf("layout %q: got %q, want %q", test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestLayoutColorSpans(t *testing.T) {
+	layout, err := newLayoutConf("[%T] %{color}%{level:long}%{reset} %M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, spans := appendRecord(nil, nil, newTestRecord(), layout)
+	if len(spans) != 2 || string(buf[spans[0]:spans[1]]) != "WARN " {
+		t.Fatalf("color spans %v of %q, want the level", spans, buf)
+	}
+}
+
+func TestLayoutNeeds(t *testing.T) {
+	tests := []struct {
+		pattern string
+		needs   sourceNeeds
+	}{
+		{"%T %L %C %M", 0},
+		{"%S", kNeedCaller},
+		{"%{file}", kNeedCaller},
+		{"%{line}", kNeedCaller},
+		{"%{function}", kNeedCaller},
+		{"%G", kNeedGoroutine},
+		{"%{thread} %S", kNeedCaller | kNeedGoroutine},
+	}
+	for _, test := range tests {
+		layout, err := newLayoutConf(test.pattern)
+		if err != nil {
+			t.Fatalf("layout %q: %v", test.pattern, err)
+		}
+		if layout.Needs != test.needs {
+			t.Errorf("layout %q needs %v, want %v", test.pattern, layout.Needs, test.needs)
+		}
+	}
+}
+
+func TestLayoutErrors(t *testing.T) {
+	tests := []struct {
+		pattern string
+		err     string
+	}{
+		{"%{unknown}", "unknown section 'unknown'"},
+		{"%{}", "unknown section ''"},
+		{"[%{level", "unclosed section %{level"},
+		{"%M %{", "unclosed section %{"},
+		{"%{level:medium}", "invalid level format 'medium', must be long or short"},
+		{"%{file:full}", "invalid file format 'full', must be long or short"},
+		{"%{function:long;%d}", "invalid function format '%d'"},
+		{"%{category:%d}", "invalid category format '%d'"},
+		{"%{line:%s}", "invalid line format '%s'"},
+	}
+	for _, test := range tests {
+		_, err := newLayoutConf(test.pattern)
+		if err == nil {
+			t.Errorf("layout %q: no error, want %q", test.pattern, test.err)
+		} else if err.Error() != test.err {
+			t.Errorf("layout %q: got error %q, want %q", test.pattern, err, test.err)
+		}
+	}
+}
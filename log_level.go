@@ -18,38 +18,43 @@ var (
 	longLevelStrings = [...]string{"DEBUG", "TRACE", "INFO ", "WARN ", "ERROR", "CRITI"}
 	//longLevelStrings = [...]string{"DEBG", "TRAC", "INFO", "WARN", "EROR", "CRIT"}
 	shortLevelStrings = [...]string{"D", "T", "I", "W", "E", "C"}
+	levelNames        = [...]string{"DEBUG", "TRACE", "INFO", "WARNING", "ERROR", "CRITICAL"}
 )
 
 func (l Level) LongString() string {
-	if l < 0 || int(l) > len(longLevelStrings) {
+	if l < 0 || int(l) >= len(longLevelStrings) {
 		return "UNKNOWN"
 	}
 	return longLevelStrings[l]
 }
 
 func (l Level) ShortString() string {
-	if l < 0 || int(l) > len(shortLevelStrings) {
+	if l < 0 || int(l) >= len(shortLevelStrings) {
 		return "UNKNOWN"
 	}
 	return shortLevelStrings[l]
 }
 
+// 等级名称，与配置中使用的名称相同
+func (l Level) String() string {
+	if l < 0 || int(l) >= len(levelNames) {
+		return "UNKNOWN"
+	}
+	return levelNames[l]
+}
+
 func strToLevel(s string) Level {
+	l, _ := parseLevel(s)
+	return l
+}
+
+// 解析等级名称，不区分大小写，无法识别时返回 DEBUG 和 false
+func parseLevel(s string) (Level, bool) {
 	s = strings.ToUpper(s)
-	l := DEBUG
-	switch s {
-	case "DEBUG":
-		l = DEBUG
-	case "TRACE":
-		l = TRACE
-	case "INFO":
-		l = INFO
-	case "WARNING":
-		l = WARNING
-	case "ERROR":
-		l = ERROR
-	case "CRITICAL":
-		l = CRITICAL
+	for i, name := range levelNames {
+		if s == name {
+			return Level(i), true
+		}
 	}
-	return l
+	return DEBUG, false
 }
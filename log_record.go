@@ -1,26 +1,120 @@
 package log4g
 
 import (
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const kBadKey = "!BADKEY"
+
 type logSource struct {
 	Tid  uint64
-	File string
-	Func string
+	File string // 完整路径
+	Func string // 包含包路径的完整函数名
 	Line int
 }
 
+// 布局需要的日志源信息，获取的代价较高，只在有布局使用时才获取
+type sourceNeeds int
+
+const (
+	kNeedCaller    sourceNeeds = 1 << iota // 文件、行号和函数名
+	kNeedGoroutine                         // 协程ID
+)
+
+// 结构化字段
+type field struct {
+	Key   string
+	Value interface{}
+}
+
+// 将交替的键值追加到 fields 的副本中，键不是字符串或缺少值时，使用 !BADKEY 作为键
+func appendFields(fields []field, kv []interface{}) []field {
+	out := make([]field, len(fields), len(fields)+(len(kv)+1)/2)
+	copy(out, fields)
+
+	for i := 0; i < len(kv); i++ {
+		key, ok := kv[i].(string)
+		if !ok || i+1 >= len(kv) {
+			out = append(out, field{Key: kBadKey, Value: kv[i]})
+			continue
+		}
+		out = append(out, field{Key: key, Value: kv[i+1]})
+		i++
+	}
+	return out
+}
+
 // A logRecord contains all of the pertinent information for each message
 type logRecord struct {
-	Category string     // The log group
-	Level    Level      // The log level
-	Created  time.Time  // The time at which the log message was created (nanoseconds)
-	Message  string     // The log message
-	Source   *logSource // The message source
+	Category string    // The log group
+	Level    Level     // The log level
+	Created  time.Time // The time at which the log message was created (nanoseconds)
+	Message  string    // The log message
+	Source   logSource // The message source, only the parts required by layouts are filled
+	Fields   []field   // Structured key/value fields
 }
 
-type formattedRecord struct {
+// 经过过滤器格式化后交给输出对象的日志记录，同一条记录会被送到过滤器下的所有输出，输出对象不能修改
+// 记录和其中的缓冲区来自缓存池，输出对象写入完成后调用 Release 归还，之后不能再访问
+type FormattedRecord struct {
 	Created   time.Time // 时间
-	Formatted string    // 格式化后的字符串，没有附件换行符
+	Level     Level     // 日志等级
+	Category  string    // 日志分类
+	Formatted []byte    // 格式化后的内容，没有附加换行符
+
+	buf   []byte // 以换行符结尾的完整内容，Formatted 为去掉换行符的部分
+	spans []int  // 布局中 %{color} 和 %{reset} 在 Formatted 中的位置，依次成对，控制台着色时使用
+	refs  int32  // 尚未调用 Release 的输出数量，减到 0 时放回缓存池
+}
+
+// 超过此长度的缓冲区不放回缓存池，避免个别很长的日志长期占用内存
+const kMaxPooledBufferSize = 64 * 1024
+
+var gRecordPool = sync.Pool{
+	New: func() interface{} {
+		return &FormattedRecord{buf: make([]byte, 0, 256)}
+	},
+}
+
+// 从缓存池获取记录，refs 为需要调用 Release 的次数，为 0 时记录不会被放回缓存池
+func getFormattedRecord(created time.Time, level Level, category string, refs int) *FormattedRecord {
+	r := gRecordPool.Get().(*FormattedRecord)
+	r.Created = created
+	r.Level = level
+	r.Category = category
+	r.buf = r.buf[:0]
+	r.spans = r.spans[:0]
+	r.refs = int32(refs)
+	return r
+}
+
+// 设置以换行符结尾的内容
+func (r *FormattedRecord) setLine(line []byte) {
+	r.buf = line
+	r.Formatted = line[:len(line)-1]
+}
+
+// 以换行符结尾的完整内容，直接构造的记录需要复制一份
+func (r *FormattedRecord) line() []byte {
+	if len(r.buf) == len(r.Formatted)+1 {
+		return r.buf
+	}
+	line := make([]byte, 0, len(r.Formatted)+1)
+	return append(append(line, r.Formatted...), '\n')
+}
+
+// 输出对象不再使用记录时调用，所有输出都调用后记录放回缓存池
+// 不调用 Release 只是记录无法重用，由垃圾回收释放
+func (r *FormattedRecord) Release() {
+	if atomic.AddInt32(&r.refs, -1) != 0 {
+		return
+	}
+	if cap(r.buf) > kMaxPooledBufferSize {
+		return
+	}
+	r.Formatted = nil
+	r.Category = ""
+	gRecordPool.Put(r)
 }
@@ -2,11 +2,12 @@ package log4g
 
 import (
 	"bytes"
+	"fmt"
 	"os"
-	"path"
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func isFileExist(path string) bool {
@@ -20,11 +21,41 @@ func isFileExist(path string) bool {
 	return true
 }
 
-// Parse a number with K/M/G suffixes based on thousands (1000) or 2^10 (1024)
+// 统计文件中换行符的数量，读取失败时返回已统计的数量
+func countLines(path string) int64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	lines := int64(0)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := f.Read(buf)
+		lines += int64(bytes.Count(buf[:n], []byte{'\n'}))
+		if err != nil {
+			return lines
+		}
+	}
+}
+
+// Parse a number with K/M/G suffixes based on thousands (1000) or 2^10 (1024), invalid string is 0
 func strToNumSuffix(str string, mult int) int64 {
+	n, _ := parseNumSuffix(str, mult)
+	return n
+}
+
+// 与 strToNumSuffix 相同，无法解析或为负数时返回错误，空字符串为 0
+func parseNumSuffix(str string, mult int) (int64, error) {
+	if str == "" {
+		return 0, nil
+	}
+
 	num := 1
-	if len(str) > 1 {
-		switch str[len(str)-1] {
+	s := str
+	if len(s) > 1 {
+		switch s[len(s)-1] {
 		case 'G', 'g':
 			num *= mult
 			fallthrough
@@ -33,39 +64,102 @@ func strToNumSuffix(str string, mult int) int64 {
 			fallthrough
 		case 'K', 'k':
 			num *= mult
-			str = str[0 : len(str)-1]
+			s = s[0 : len(s)-1]
 		}
 	}
-	parsed, _ := strconv.Atoi(str)
-	return int64(parsed) * int64(num)
+	parsed, err := strconv.Atoi(s)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid number %s", str)
+	}
+	return int64(parsed) * int64(num), nil
+}
+
+// Parse a duration with s/m/h/d suffixes, d means 24 hours, invalid string is 0
+func strToDuration(str string) time.Duration {
+	d, _ := parseDuration(str)
+	return d
+}
+
+// 与 strToDuration 相同，无法解析时返回错误，空字符串为 0
+func parseDuration(str string) (time.Duration, error) {
+	if str == "" {
+		return 0, nil
+	}
+
+	if strings.HasSuffix(str, "d") {
+		days, err := strconv.Atoi(str[:len(str)-1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %s", str)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %s", str)
+	}
+	return d, nil
 }
 
 func getGoroutineID() uint64 {
-	b := make([]byte, 64)
-	b = b[:runtime.Stack(b, false)]
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
 	b = bytes.TrimPrefix(b, []byte("goroutine "))
-	b = b[:bytes.IndexByte(b, ' ')]
-	n, _ := strconv.ParseUint(string(b), 10, 64)
+
+	n := uint64(0)
+	for _, ch := range b {
+		if ch < '0' || ch > '9' {
+			break
+		}
+		n = n*10 + uint64(ch-'0')
+	}
 	return n
 }
 
-func getSource(skip int) *logSource {
-	src := &logSource{}
-	src.Tid = getGoroutineID()
+// 获取调用位置和协程ID，needs 中没有的部分不获取
+func getSource(skip int, needs sourceNeeds) logSource {
+	src := logSource{}
+	if needs&kNeedGoroutine != 0 {
+		src.Tid = getGoroutineID()
+	}
+	if needs&kNeedCaller == 0 {
+		return src
+	}
 
 	pc, file, line, ok := runtime.Caller(skip)
 	if !ok {
 		return src
 	}
 
-	funcName := runtime.FuncForPC(pc).Name()
-	if idx := strings.LastIndex(funcName, "."); idx >= 0 {
-		funcName = funcName[idx+1:]
+	src.File = file
+	src.Func = runtime.FuncForPC(pc).Name()
+	src.Line = line
+
+	return src
+}
+
+// 根据 runtime.Callers 返回的 pc 获取源代码位置，pc 为 0 时只有协程ID
+func getSourcePC(pc uintptr, needs sourceNeeds) logSource {
+	src := logSource{}
+	if needs&kNeedGoroutine != 0 {
+		src.Tid = getGoroutineID()
+	}
+	if pc == 0 || needs&kNeedCaller == 0 {
+		return src
 	}
 
-	src.File = path.Base(file)
-	src.Func = funcName
-	src.Line = line
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	src.File = frame.File
+	src.Func = frame.Function
+	src.Line = frame.Line
 
 	return src
 }
+
+// 去掉包路径和类型，只保留函数名
+func shortFuncName(funcName string) string {
+	if idx := strings.LastIndex(funcName, "."); idx >= 0 {
+		return funcName[idx+1:]
+	}
+	return funcName
+}
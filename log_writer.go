@@ -1,18 +1,74 @@
 package log4g
 
-import "fmt"
+import (
+	"fmt"
+	"github.com/go-yaml/yaml"
+	"sync"
+)
 
 /**
  * 输出接口，可以输出到文件、控制台、网络 ...
+ * 自定义的输出实现此接口后通过 RegisterWriterType 注册，即可在配置的 files 段中使用
+ * Write 不能修改 rec ，使用完成后调用一次 rec.Release() 将记录归还缓存池，异步写入时在写入完成后调用
  */
-type logWriter interface {
-	Write(msg *formattedRecord)
+type Writer interface {
+	Write(rec *FormattedRecord)
 	Close()
 }
 
+// 输出对象的创建函数，name 为 files 段中的输出名称，options 为该输出下的全部配置项(包含 type)
+type WriterFactory func(name string, options map[string]interface{}) (Writer, error)
+
+var (
+	gWriterTypesMu sync.RWMutex
+	gWriterTypes   = map[string]WriterFactory{
+		kFileWriterType:    fileWriterFactory,
+		kConsoleWriterType: consoleWriterFactory,
+	}
+)
+
+// 注册输出类型，配置中 files 段的 type 为 name 时，使用 factory 创建输出对象
+// 重复注册或 factory 为 nil 时 panic
+func RegisterWriterType(name string, factory WriterFactory) {
+	gWriterTypesMu.Lock()
+	defer gWriterTypesMu.Unlock()
+
+	if factory == nil {
+		panic("log4g: RegisterWriterType factory is nil")
+	}
+	if _, ok := gWriterTypes[name]; ok {
+		panic("log4g: RegisterWriterType called twice for type " + name)
+	}
+	gWriterTypes[name] = factory
+}
+
+func getWriterFactory(name string) (WriterFactory, bool) {
+	gWriterTypesMu.RLock()
+	defer gWriterTypesMu.RUnlock()
+
+	factory, ok := gWriterTypes[name]
+	return factory, ok
+}
+
+// 将输出的配置项解析到 out 指向的结构体中，字段使用 yaml 标签匹配，json 和 yaml 配置都适用
+func DecodeWriterOptions(options map[string]interface{}, out interface{}) error {
+	content, err := yaml.Marshal(options)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(content, out)
+}
+
+func newWriter(name string, cfg outputSecCfg) (Writer, error) {
+	factory, ok := getWriterFactory(cfg.Type())
+	if !ok {
+		return nil, fmt.Errorf("unknown output type %s", cfg.Type())
+	}
+	return factory(name, cfg)
+}
 
 func doRecover() {
 	if err := recover(); err != nil {
 		fmt.Println("recover:", err)
 	}
-}
\ No newline at end of file
+}
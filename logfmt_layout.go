@@ -0,0 +1,53 @@
+package log4g
+
+import (
+	"strconv"
+	"strings"
+)
+
+// logfmt 布局中的等级名称，小写且不补齐
+var logfmtLevelNames = func() [len(levelNames)]string {
+	var names [len(levelNames)]string
+	for i, name := range levelNames {
+		names[i] = strings.ToLower(name)
+	}
+	return names
+}()
+
+/**
+ * logfmt 布局，每条日志输出为一行 key=value ，值包含空白、引号、'=' 或为空时加引号
+ *	time=2006-01-02T15:04:05.000Z07:00 level=info category=db msg="connect ok" k1=v1
+ */
+type logfmtLayout struct {
+	timeFormat *timeFormatter
+}
+
+func newLogfmtLayout(timeFormat string) *logfmtLayout {
+	if timeFormat == "" {
+		timeFormat = kDefaultJsonTimeFormat
+	}
+	return &logfmtLayout{timeFormat: newTimeFormatter(timeFormat)}
+}
+
+func (ll *logfmtLayout) appendRecord(buf []byte, rec *logRecord) []byte {
+	buf = append(buf, "time="...)
+	buf = ll.timeFormat.appendTime(buf, rec.Created)
+
+	buf = append(buf, " level="...)
+	if rec.Level >= 0 && int(rec.Level) < len(logfmtLevelNames) {
+		buf = append(buf, logfmtLevelNames[rec.Level]...)
+	} else {
+		buf = strconv.AppendInt(buf, int64(rec.Level), 10)
+	}
+
+	buf = append(buf, " category="...)
+	buf = appendFieldValue(buf, rec.Category)
+	buf = append(buf, " msg="...)
+	buf = appendFieldValue(buf, rec.Message)
+
+	if len(rec.Fields) > 0 {
+		buf = append(buf, ' ')
+		buf = appendFieldsText(buf, rec.Fields)
+	}
+	return buf
+}
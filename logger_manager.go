@@ -1,23 +1,44 @@
 package log4g
 
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
 var (
-	gLoggerMgr     = map[string]*category{}
-	gDefaultLogger = newDefaultCategory("console")
-
-	Critical       = gDefaultLogger.Critical
-	CriticalF      = gDefaultLogger.CriticalF
-	Error          = gDefaultLogger.Error
-	ErrorF         = gDefaultLogger.ErrorF
-	Warn           = gDefaultLogger.Warn
-	WarnF          = gDefaultLogger.WarnF
-	Info           = gDefaultLogger.Info
-	InfoF          = gDefaultLogger.InfoF
-	Debug          = gDefaultLogger.Debug
-	DebugF         = gDefaultLogger.DebugF
-	Trace          = gDefaultLogger.Trace
-	TraceF         = gDefaultLogger.TraceF
-	Log            = gDefaultLogger.Log
-	LogF           = gDefaultLogger.LogF
+	gLoggerMu  sync.Mutex                 // 保护 gLoggerMgr 和 gOutputs，日志输出时不需要加锁
+	gLoggerMgr = map[string]*category{}   // 所有通过配置或 GetLogger 创建的分类
+	gOutputs   = map[string]*outputInfo{} // 当前配置创建的输出对象，重新加载配置时复用配置未变化的输出
+)
+
+var (
+	gDefaultLogger Logger = getCategory("console")
+
+	Critical   = gDefaultLogger.Critical
+	CriticalF  = gDefaultLogger.CriticalF
+	CriticalFn = gDefaultLogger.CriticalFn
+	Error      = gDefaultLogger.Error
+	ErrorF     = gDefaultLogger.ErrorF
+	ErrorFn    = gDefaultLogger.ErrorFn
+	Warn       = gDefaultLogger.Warn
+	WarnF      = gDefaultLogger.WarnF
+	WarnFn     = gDefaultLogger.WarnFn
+	Info       = gDefaultLogger.Info
+	InfoF      = gDefaultLogger.InfoF
+	InfoFn     = gDefaultLogger.InfoFn
+	Debug      = gDefaultLogger.Debug
+	DebugF     = gDefaultLogger.DebugF
+	DebugFn    = gDefaultLogger.DebugFn
+	Trace      = gDefaultLogger.Trace
+	TraceF     = gDefaultLogger.TraceF
+	TraceFn    = gDefaultLogger.TraceFn
+	Log        = gDefaultLogger.Log
+	LogF       = gDefaultLogger.LogF
+	LogFn      = gDefaultLogger.LogFn
+	IsEnabled  = gDefaultLogger.IsEnabled
+	With       = gDefaultLogger.With
 )
 
 func SetDefaultLogger(name string) {
@@ -25,18 +46,27 @@ func SetDefaultLogger(name string) {
 
 	Critical = gDefaultLogger.Critical
 	CriticalF = gDefaultLogger.CriticalF
+	CriticalFn = gDefaultLogger.CriticalFn
 	Error = gDefaultLogger.Error
 	ErrorF = gDefaultLogger.ErrorF
+	ErrorFn = gDefaultLogger.ErrorFn
 	Warn = gDefaultLogger.Warn
 	WarnF = gDefaultLogger.WarnF
+	WarnFn = gDefaultLogger.WarnFn
 	Info = gDefaultLogger.Info
 	InfoF = gDefaultLogger.InfoF
+	InfoFn = gDefaultLogger.InfoFn
 	Debug = gDefaultLogger.Debug
 	DebugF = gDefaultLogger.DebugF
+	DebugFn = gDefaultLogger.DebugFn
 	Trace = gDefaultLogger.Trace
 	TraceF = gDefaultLogger.TraceF
+	TraceFn = gDefaultLogger.TraceFn
 	Log = gDefaultLogger.Log
 	LogF = gDefaultLogger.LogF
+	LogFn = gDefaultLogger.LogFn
+	IsEnabled = gDefaultLogger.IsEnabled
+	With = gDefaultLogger.With
 }
 
 func LoadYamlFile(path string) error {
@@ -51,22 +81,128 @@ func LoadJsonString(js string) error {
 	return loadJsonString(js)
 }
 
-// 关闭所有的文件
+// 关闭所有的文件，停止监视配置文件和信号，所有分类恢复为默认输出到控制台
+// 等待所有已经写入的日志输出完成后返回
 func Close() {
-	for _, c := range gLoggerMgr {
-		for _, f := range c.filters {
-			for _, w := range f.writers {
-				w.Close()
+	closeAll(context.Background())
+}
+
+// 与 Close 相同，但最多等待 timeout ，超时后丢弃文件等输出中还没有输出的日志，返回丢弃的数量
+// 控制台和标准错误的队列不会丢弃，超时后剩余的日志仍会在后台输出
+func CloseWithTimeout(timeout time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	dropped := closeAll(ctx)
+	return dropped, ctx.Err()
+}
+
+// 先将所有分类从输出上摘下，再依次关闭输出，控制台和标准错误最后刷新，因为分类恢复默认后会输出到控制台
+func closeAll(ctx context.Context) int {
+	stopWatch()
+	stopReopenOnSignal()
+
+	gLoggerMu.Lock()
+	unused, retired := applyFullCfg(newCategoryTree(), map[string]*outputInfo{})
+	gLoggerMu.Unlock()
+
+	waitInflight(ctx, retired)
+	dropped := 0
+	for _, w := range unused {
+		dropped += closeWriter(ctx, w)
+	}
+
+	// 控制台和标准错误不会关闭，超时后队列中的日志仍会输出，不计入丢弃的数量
+	for _, w := range loadConsoleStreams().writers {
+		_ = w.Flush(ctx)
+	}
+	return dropped
+}
+
+// 等待所有输出中已经写入的日志输出完成，并同步到磁盘
+func Flush(ctx context.Context) error {
+	gLoggerMu.Lock()
+	writers := make([]Writer, 0, len(gOutputs)+2)
+	for _, info := range gOutputs {
+		writers = append(writers, info.writer)
+	}
+	gLoggerMu.Unlock()
+	for _, w := range loadConsoleStreams().writers {
+		writers = append(writers, w)
+	}
+
+	for _, w := range writers {
+		if f, ok := w.(Flusher); ok {
+			if err := f.Flush(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 所有输出重新打开文件，配合 logrotate 的 create 模式使用，返回第一个失败的错误
+func Reopen() error {
+	gLoggerMu.Lock()
+	writers := make([]Writer, 0, len(gOutputs))
+	for _, info := range gOutputs {
+		writers = append(writers, info.writer)
+	}
+	gLoggerMu.Unlock()
+
+	var first error
+	for _, w := range writers {
+		if r, ok := w.(Reopener); ok {
+			if err := r.Reopen(); err != nil && first == nil {
+				first = err
 			}
 		}
 	}
-	gLoggerMgr = map[string]*category{}
+	return first
+}
+
+// 设置输出是否异步写入，与配置中的 async 相同，output 为 files 段中的输出名称，或者 console 、 stderr
+// 控制台输出设置的是所使用的流，同一个流上的所有控制台输出都会受影响
+// 同步写入时日志接口返回前已经写入，适合测试，以及崩溃或 os.Exit 前需要保证日志不丢失的场景
+// 重新加载配置时，配置有变化的输出会重新创建，按新的配置设置
+func SetAsync(output string, async bool) error {
+	gLoggerMu.Lock()
+	var w Writer
+	if info, ok := gOutputs[output]; ok {
+		w = info.writer
+	} else if b := builtinOutput(output); b != nil {
+		w = b
+	}
+	gLoggerMu.Unlock()
+
+	switch w := w.(type) {
+	case nil:
+		return fmt.Errorf("unknown output %s", output)
+	case *consoleOutput:
+		for _, s := range w.streams() {
+			s.setAsync(async)
+		}
+	case *asyncWriter:
+		w.setAsync(async)
+	default:
+		return fmt.Errorf("output %s does not support async setting", output)
+	}
+	return nil
 }
 
 func GetLogger(name string) Logger {
-	lg, ok := gLoggerMgr[name]
-	if ok {
-		return lg
+	gLoggerMu.Lock()
+	defer gLoggerMu.Unlock()
+	return getCategory(name)
+}
+
+// 获取分类，不存在时按当前配置中的层级创建并注册，以便重新加载配置时能够更新，调用者需持有 gLoggerMu
+func getCategory(name string) *category {
+	c, ok := gLoggerMgr[name]
+	if !ok {
+		c = &category{category: name}
+		c.setFilters(currentCategoryTree().resolve(name))
+		gLoggerMgr[name] = c
 	}
-	return newDefaultCategory(name)
+	return c
 }
@@ -0,0 +1,81 @@
+package log4g
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var (
+	gSignalMu      sync.Mutex
+	gSignalHandler *signalHandler // 当前的信号处理，同一时间只有一个
+)
+
+/**
+ * 收到信号后重新打开所有输出的文件
+ */
+type signalHandler struct {
+	ch   chan os.Signal
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// 收到 sigs 中的信号时重新打开所有输出的文件，未指定信号时为 SIGHUP
+// logrotate 使用 create 模式移走文件后，在 postrotate 中发送信号即可写入新的文件
+// 再次调用时替换之前的设置，Close 后不再处理
+func ReopenOnSignal(sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+
+	h := &signalHandler{
+		ch:   make(chan os.Signal, 1),
+		done: make(chan struct{}),
+	}
+
+	gSignalMu.Lock()
+	defer gSignalMu.Unlock()
+
+	if gSignalHandler != nil {
+		gSignalHandler.stop()
+	}
+	gSignalHandler = h
+
+	signal.Notify(h.ch, sigs...)
+	h.wg.Add(1)
+	go h.run()
+}
+
+func stopReopenOnSignal() {
+	gSignalMu.Lock()
+	defer gSignalMu.Unlock()
+
+	if gSignalHandler != nil {
+		gSignalHandler.stop()
+		gSignalHandler = nil
+	}
+}
+
+func (h *signalHandler) stop() {
+	signal.Stop(h.ch)
+	close(h.done)
+	h.wg.Wait()
+}
+
+func (h *signalHandler) run() {
+	defer h.wg.Done()
+	defer doRecover()
+
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-h.ch:
+			if err := Reopen(); err != nil {
+				fmt.Println("reopen log files fail:", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+//go:build go1.21
+// +build go1.21
+
+package log4g
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// slog 的等级对应到 Level ，DEBUG 和 INFO 之间的等级对应 TRACE ，ERROR+4 及以上对应 CRITICAL
+func slogLevelToLevel(l slog.Level) Level {
+	switch {
+	case l >= slog.LevelError+4:
+		return CRITICAL
+	case l >= slog.LevelError:
+		return ERROR
+	case l >= slog.LevelWarn:
+		return WARNING
+	case l >= slog.LevelInfo:
+		return INFO
+	case l > slog.LevelDebug:
+		return TRACE
+	}
+	return DEBUG
+}
+
+// SlogHandler 的选项
+type SlogHandlerOptions struct {
+	// 按此属性的值选择分类，eg. "logger" ，记录中没有此属性时使用默认分类，此属性不会作为字段输出
+	// 路由到的分类不注册，按当前配置中的层级输出，不会出现在 NewAdminHandler 的分类列表中
+	// 属性值的数量不受限制，但只缓存前 1024 个分类的过滤器，值过多时每条日志都要重新计算
+	RouteKey string
+}
+
+/**
+ * 实现 slog.Handler ，将 slog 的日志送到 log4g 的分类中，属性和分组作为结构化字段输出
+ * eg. slog.SetDefault(slog.New(log4g.NewSlogHandler("app", nil)))
+ */
+type SlogHandler struct {
+	category *category // 默认分类
+	routeKey string
+	route    string  // WithAttrs 中指定的分类
+	fields   []field // WithAttrs 添加的字段
+	prefix   string  // WithGroup 添加的分组，以 '.' 结尾
+}
+
+func NewSlogHandler(category string, opts *SlogHandlerOptions) *SlogHandler {
+	gLoggerMu.Lock()
+	c := getCategory(category)
+	gLoggerMu.Unlock()
+
+	h := &SlogHandler{
+		category: c,
+	}
+	if opts != nil {
+		h.routeKey = opts.RouteKey
+	}
+	return h
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	// 路由后的分类要处理记录时才知道，这里只能使用默认分类判断
+	if h.routeKey != "" {
+		return true
+	}
+	if h.route != "" {
+		return currentCategoryTree().resolveRouted(h.route).isEnabled(slogLevelToLevel(level))
+	}
+	return h.category.IsEnabled(slogLevelToLevel(level))
+}
+
+func (h *SlogHandler) Handle(_ context.Context, r slog.Record) error {
+	route := h.route
+	fields := make([]field, len(h.fields), len(h.fields)+r.NumAttrs())
+	copy(fields, h.fields)
+
+	r.Attrs(func(a slog.Attr) bool {
+		if h.routeKey != "" && h.prefix == "" && a.Key == h.routeKey {
+			route = a.Value.Resolve().String()
+			return true
+		}
+		fields = appendAttr(fields, h.prefix, a)
+		return true
+	})
+
+	level := slogLevelToLevel(r.Level)
+	var set *filterSet
+	if route == "" {
+		if !h.category.IsEnabled(level) {
+			return nil
+		}
+		route = h.category.category
+		set = h.category.acquireFilterSet()
+		defer set.active.leave()
+	} else {
+		// 路由的分类不注册，直接按当前配置计算过滤器，避免属性值过多时分类无限增长
+		t := acquireCategoryTree()
+		defer t.active.leave()
+
+		set = t.resolveRouted(route)
+		if !set.isEnabled(level) {
+			return nil
+		}
+	}
+
+	created := r.Time
+	if created.IsZero() {
+		created = time.Now()
+	}
+
+	set.dispatch(&logRecord{
+		Category: route,
+		Level:    level,
+		Created:  created,
+		Message:  r.Message,
+		Source:   getSourcePC(r.PC, set.needs),
+		Fields:   fields,
+	})
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	h2 := *h
+	h2.fields = make([]field, len(h.fields), len(h.fields)+len(attrs))
+	copy(h2.fields, h.fields)
+
+	for _, a := range attrs {
+		if h.routeKey != "" && h.prefix == "" && a.Key == h.routeKey {
+			h2.route = a.Value.Resolve().String()
+			continue
+		}
+		h2.fields = appendAttr(h2.fields, h.prefix, a)
+	}
+	return &h2
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// 将属性追加为字段，分组展开为 group.key ，忽略空的属性
+func appendAttr(fields []field, prefix string, a slog.Attr) []field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if a.Key != "" {
+			groupPrefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			fields = appendAttr(fields, groupPrefix, ga)
+		}
+		return fields
+	}
+
+	return append(fields, field{Key: prefix + a.Key, Value: a.Value.Any()})
+}
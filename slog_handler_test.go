@@ -0,0 +1,52 @@
+//go:build go1.21
+// +build go1.21
+
+package log4g
+
+import (
+	"fmt"
+	"log/slog"
+	"testing"
+)
+
+func TestSlogRouteDoesNotRegister(t *testing.T) {
+	err := LoadJsonString(`{
+		"files": {"capture": {"type": "test_capture"}},
+		"layouts": {"plain": "%C %M"},
+		"categories": {"db": {"enable": true, "filters": [{"layout": "plain", "output": ["capture"]}]}}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	logger := slog.New(NewSlogHandler("app", &SlogHandlerOptions{RouteKey: "logger"}))
+
+	gLoggerMu.Lock()
+	registered := len(gLoggerMgr)
+	gLoggerMu.Unlock()
+
+	const n = 2 * kMaxRoutedCategories
+	for i := 0; i < n; i++ {
+		logger.Info("hello", "logger", fmt.Sprintf("db.conn%d", i))
+	}
+
+	gLoggerMu.Lock()
+	after := len(gLoggerMgr)
+	gLoggerMu.Unlock()
+	if after != registered {
+		t.Fatalf("routing registered %d categories", after-registered)
+	}
+
+	if count := currentCategoryTree().routedCount; count > kMaxRoutedCategories {
+		t.Fatalf("cached %d routed categories, limit is %d", count, kMaxRoutedCategories)
+	}
+
+	lines := gCaptureWriter.getLines()
+	if len(lines) != n {
+		t.Fatalf("got %d lines, want %d", len(lines), n)
+	}
+	if lines[n-1] != fmt.Sprintf("db.conn%d hello", n-1) {
+		t.Fatalf("last line %q", lines[n-1])
+	}
+}
@@ -0,0 +1,79 @@
+package log4g
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"sync"
+)
+
+// log.Logger 的 Printf 等方法经过 output 后才调用 Write ，需要额外跳过两层
+const kStdLoggerSkip = 2
+
+// 创建标准库的 log.Logger ，输出的每一行作为一条 level 等级的日志写入分类，源代码位置为调用 Printf 等方法的位置
+// eg. http.Server{ErrorLog: log4g.NewStdLogger("http", log4g.ERROR)}
+// 重定向标准库的全局 logger 时使用它的 Writer ，源代码位置同样为调用 log.Printf 等函数的位置
+// eg. log.SetOutput(log4g.NewStdLogger("std", log4g.INFO).Writer())
+func NewStdLogger(category string, level Level) *log.Logger {
+	return log.New(newLineWriter(category, level, kStdLoggerSkip), "", 0)
+}
+
+// 创建 io.Writer ，写入的内容按换行分割，每一行作为一条 level 等级的日志写入分类
+// 没有换行结尾的内容会保留到下次写入，源代码位置为直接调用 Write 的位置，
+// 经过其他库转发时是转发处的位置，例如 log.SetOutput 后总是 log.go ，此时应该使用 NewStdLogger 的 Writer
+func NewIOWriter(category string, level Level) io.Writer {
+	return newLineWriter(category, level, 0)
+}
+
+func newLineWriter(name string, level Level, skip int) *lineWriter {
+	gLoggerMu.Lock()
+	parent := getCategory(name)
+	gLoggerMu.Unlock()
+
+	return &lineWriter{
+		c: &category{
+			category: name,
+			extSkip:  skip,
+			parent:   parent,
+		},
+		level: level,
+	}
+}
+
+/**
+ * 按行写入分类的 io.Writer
+ */
+type lineWriter struct {
+	c     *category
+	level Level
+
+	mu  sync.Mutex
+	buf []byte // 还没有遇到换行的内容
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := len(p)
+	for len(p) > 0 {
+		idx := bytes.IndexByte(p, '\n')
+		if idx < 0 {
+			w.buf = append(w.buf, p...)
+			break
+		}
+
+		line := p[:idx]
+		if len(w.buf) > 0 {
+			line = append(w.buf, line...)
+			w.buf = w.buf[:0]
+		}
+		p = p[idx+1:]
+
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+		if len(line) > 0 && w.c.IsEnabled(w.level) {
+			w.c.internalLog(w.level, string(line))
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,86 @@
+package log4g
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// 测试用的输出，同步记录写入的每一行
+type captureWriter struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (w *captureWriter) Write(rec *FormattedRecord) {
+	w.mu.Lock()
+	w.lines = append(w.lines, string(rec.Formatted))
+	w.mu.Unlock()
+	rec.Release()
+}
+
+func (w *captureWriter) Close() {
+}
+
+func (w *captureWriter) getLines() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.lines...)
+}
+
+var gCaptureWriter *captureWriter // test_capture 类型最近创建的输出
+
+func init() {
+	RegisterWriterType("test_capture", func(_ string, _ map[string]interface{}) (Writer, error) {
+		gCaptureWriter = &captureWriter{}
+		return gCaptureWriter, nil
+	})
+}
+
+// 返回调用者下一行的位置，与 %S 的格式相同
+func nextLine() string {
+	_, file, line, _ := runtime.Caller(1)
+	return fmt.Sprintf("%s:%d", filepath.Base(file), line+1)
+}
+
+func TestStdBridgeSource(t *testing.T) {
+	err := LoadJsonString(`{
+		"files": {"capture": {"type": "test_capture"}},
+		"layouts": {"source": "%S %M"},
+		"categories": {"std_test": {"enable": true, "filters": [{"layout": "source", "output": ["capture"]}]}}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	var want []string
+	l := NewStdLogger("std_test", INFO)
+	want = append(want, nextLine()+" logger")
+	l.Printf("logger")
+
+	out, flags, prefix := log.Writer(), log.Flags(), log.Prefix()
+	log.SetOutput(l.Writer())
+	log.SetFlags(0)
+	log.SetPrefix("")
+	want = append(want, nextLine()+" global")
+	log.Printf("global")
+	log.SetOutput(out)
+	log.SetFlags(flags)
+	log.SetPrefix(prefix)
+
+	// 没有换行结尾的内容与下次写入的内容合并为一行，位置为写入换行的调用
+	w := NewIOWriter("std_test", INFO)
+	want = append(want, nextLine()+" writer")
+	w.Write([]byte("writer\npartial"))
+	want = append(want, nextLine()+" partial line")
+	w.Write([]byte(" line\n"))
+
+	lines := gCaptureWriter.getLines()
+	if !equalStrings(lines, want) {
+		t.Fatalf("got %q, want %q", lines, want)
+	}
+}
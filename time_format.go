@@ -0,0 +1,102 @@
+package log4g
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * 按秒缓存格式化后的时间，同一秒内的日志只需要填充小数秒
+ * 格式以 .000 或 ,000 形式的小数秒分割为前后两段，分别缓存格式化的结果
+ * 使用 .999 形式的小数秒时，输出长度不固定，不使用缓存
+ */
+type timeFormatter struct {
+	format string
+	prefix string // 小数秒之前的格式，没有小数秒时为完整格式
+	suffix string // 小数秒之后的格式
+	sep    byte   // 小数点，'.' 或 ','
+	digits int    // 小数秒位数，0 表示没有小数秒
+	cached bool   // 是否可以缓存
+	cache  atomic.Value
+}
+
+// 缓存的一秒内的格式化结果
+type cachedTime struct {
+	sec    int64
+	loc    *time.Location
+	prefix []byte
+	suffix []byte
+}
+
+func newTimeFormatter(format string) *timeFormatter {
+	tf := &timeFormatter{format: format, prefix: format, cached: true}
+
+	for i := 0; i+1 < len(format); i++ {
+		if format[i] != '.' && format[i] != ',' {
+			continue
+		}
+		if format[i+1] != '0' && format[i+1] != '9' {
+			continue
+		}
+
+		j := i + 1
+		for j < len(format) && format[j] == format[i+1] {
+			j++
+		}
+		if j < len(format) && format[j] >= '0' && format[j] <= '9' {
+			continue
+		}
+
+		if format[i+1] == '9' || strings.ContainsAny(format[j:], ".,") {
+			tf.cached = false
+			return tf
+		}
+
+		tf.prefix, tf.suffix = format[:i], format[j:]
+		tf.sep = format[i]
+		tf.digits = j - i - 1
+		break
+	}
+
+	return tf
+}
+
+// 按格式追加时间到 buf 中
+func (tf *timeFormatter) appendTime(buf []byte, t time.Time) []byte {
+	if !tf.cached {
+		return t.AppendFormat(buf, tf.format)
+	}
+
+	sec := t.Unix()
+	c, _ := tf.cache.Load().(*cachedTime)
+	if c == nil || c.sec != sec || c.loc != t.Location() {
+		c = &cachedTime{
+			sec:    sec,
+			loc:    t.Location(),
+			prefix: t.AppendFormat(nil, tf.prefix),
+			suffix: t.AppendFormat(nil, tf.suffix),
+		}
+		tf.cache.Store(c)
+	}
+
+	buf = append(buf, c.prefix...)
+	if tf.digits > 0 {
+		buf = append(buf, tf.sep)
+		buf = appendFraction(buf, t.Nanosecond(), tf.digits)
+	}
+	return append(buf, c.suffix...)
+}
+
+// 追加 nsec 纳秒的前 digits 位小数
+func appendFraction(buf []byte, nsec int, digits int) []byte {
+	if digits > 9 {
+		digits = 9
+	}
+	var tmp [9]byte
+	for i := 8; i >= 0; i-- {
+		tmp[i] = byte('0' + nsec%10)
+		nsec /= 10
+	}
+	return append(buf, tmp[:digits]...)
+}